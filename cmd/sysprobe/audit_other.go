@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+// openRootAudit fails, as there is no system log to record commands in
+func openRootAudit() (func(task sysprobe.Task, command string) error, error) {
+	return nil, errors.New("no system log on this platform")
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/syslog"
+	"os"
+	"os/user"
+	"strings"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+// openRootAudit opens the system log for the escalation helper, which
+// records every command before running it as root. Unlike the user's audit
+// log, the entries cannot be edited by the user afterwards.
+func openRootAudit() (func(task sysprobe.Task, command string) error, error) {
+	logger, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, "sysprobe")
+	if err != nil {
+		return nil, err
+	}
+	uid := invokingUID()
+	return func(task sysprobe.Task, command string) error {
+		return logger.Notice(fmt.Sprintf("uid=%s task=%q command=%q", uid, task.Name, command))
+	}, nil
+}
+
+// invokingUID returns the real UID of the user the helper runs for. The
+// parent process is sudo or the unprivileged sysprobe itself, and keeps the
+// user's real UID; the variables set by the escalation method are the
+// fallback where /proc is not available.
+func invokingUID() string {
+	if f, err := os.Open(fmt.Sprintf("/proc/%d/status", os.Getppid())); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rest, ok := strings.CutPrefix(scanner.Text(), "Uid:"); ok {
+				if fields := strings.Fields(rest); len(fields) > 0 {
+					return fields[0]
+				}
+			}
+		}
+	}
+	for _, name := range []string{"SUDO_UID", "PKEXEC_UID"} {
+		if uid := os.Getenv(name); uid != "" {
+			return uid
+		}
+	}
+	if name := os.Getenv("DOAS_USER"); name != "" {
+		if u, err := user.Lookup(name); err == nil {
+			return u.Uid
+		}
+	}
+	return "unknown"
+}
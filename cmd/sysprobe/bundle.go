@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/bundle"
+)
+
+// bundleKeepBytes is how much of each command's stdout and stderr is kept
+// for a support bundle, regardless of max_bytes
+const bundleKeepBytes = 16 << 20
+
+// bundleRun is a finished run to be saved as a support bundle
+type bundleRun struct {
+	probesDir string
+	platform  sysprobe.Platform
+	results   []sysprobe.Result // redacted
+	checks    []sysprobe.Check
+	recorder  *sysprobe.Recorder
+	redaction sysprobe.RedactLevel
+	started   time.Time
+	finished  time.Time
+	mode      sysprobe.Mode
+	maxTokens int
+}
+
+// writeBundle saves the recorded output of a run with the manifests it
+// loaded and its Markdown and JSON reports
+func writeBundle(path string, run bundleRun) error {
+	sources, err := sysprobe.DefaultSources(run.probesDir)
+	if err != nil {
+		return err
+	}
+
+	b := &bundle.Bundle{
+		Metadata: bundle.Metadata{
+			Version:    bundle.Version,
+			Tool:       version,
+			Args:       os.Args[1:],
+			Platform:   run.platform,
+			Redaction:  run.redaction.String(),
+			Started:    run.started.UTC(),
+			Finished:   run.finished.UTC(),
+			DurationMS: run.finished.Sub(run.started).Milliseconds(),
+			Tasks:      bundle.NewTaskTimings(run.results),
+		},
+		Fixture: run.recorder.Fixture(),
+		Reports: make(map[string]string),
+	}
+	for _, source := range sources {
+		b.Sources = append(b.Sources, bundle.Source{Name: source.Name, FS: source.FS})
+		b.Metadata.Sources = append(b.Metadata.Sources, source.Name)
+	}
+
+	markdown, _, err := generateReport(run.platform, run.results, run.checks, run.finished, run.mode, sysprobe.FormatMarkdown, run.maxTokens)
+	if err != nil {
+		return err
+	}
+	b.Reports["report.md"] = markdown
+	json, _, err := generateReport(run.platform, run.results, run.checks, run.finished, sysprobe.ModeFull, sysprobe.FormatJSON, 0)
+	if err != nil {
+		return err
+	}
+	b.Reports["report.json"] = json
+
+	return b.Write(path)
+}
+
+// runReport implements the "report" subcommand, which renders a report from
+// a support bundle without running anything
+func runReport(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	from := flags.String("from", "", "Support bundle (.tar.zst) to render")
+	outputFile := flags.String("o", "", "Output file path for the report (default stdout)")
+	minified := flags.Bool("minified", false, "Generate minified output for smaller token count")
+	intro := flags.Bool("intro", false, "Generate only system intro for LLM chat context")
+	format := flags.String("format", "markdown", "Report format: markdown, json or jsonl")
+	redactLevel := flags.String("redact", "standard", "Redact addresses, identifiers and secrets: strict, standard or off")
+	maxTokens := flags.Int("max-tokens", 0, "Fit the Markdown report into this many tokens (0 for no limit)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe report --from <bundle> [flags]")
+		fmt.Fprintln(os.Stderr, "\nRenders the run saved in a support bundle again, with the manifests it used.")
+		fmt.Fprintln(os.Stderr, "Output is redacted when the bundle is made; --redact can only redact more.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *from == "" || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	reportFormat, err := sysprobe.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	level, err := sysprobe.ParseRedactLevel(*redactLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	mode := sysprobe.ModeFull
+	if *intro {
+		mode = sysprobe.ModeIntro
+	} else if *minified {
+		mode = sysprobe.ModeMinified
+	}
+
+	content, tokenCount, err := renderBundle(*from, mode, reportFormat, *maxTokens, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	writeOutput(*outputFile, content, tokenCount, "Report")
+}
+
+// renderBundle replays the fixture in a bundle through its manifests and
+// renders the results
+func renderBundle(path string, mode sysprobe.Mode, format sysprobe.Format, maxTokens int, level sysprobe.RedactLevel) (string, int, error) {
+	manifestDir, err := os.MkdirTemp("", "sysprobe-bundle-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.RemoveAll(manifestDir)
+
+	b, err := bundle.Read(path, manifestDir)
+	if err != nil {
+		return "", 0, err
+	}
+	plat := b.Metadata.Platform
+
+	sources := make([]sysprobe.Source, len(b.Sources))
+	for i, source := range b.Sources {
+		sources[i] = sysprobe.Source{Name: source.Name, FS: source.FS}
+	}
+	probes, err := sysprobe.LoadProbes(sysprobe.WithPlatform(plat), sysprobe.WithSources(sources...))
+	if err != nil {
+		return "", 0, err
+	}
+	tasks := b.Fixture.Filter(probes.Tasks)
+	if mode == sysprobe.ModeIntro {
+		tasks = sysprobe.IntroTasks(tasks)
+	}
+
+	var results []sysprobe.Result
+	for event := range sysprobe.Run(context.Background(), tasks, sysprobe.WithPlatform(plat), sysprobe.WithReplay(b.Fixture), sysprobe.WithRedaction(level)) {
+		if event.Type == sysprobe.EventFinished {
+			results, err = event.Results, event.Err
+		}
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return generateReport(plat, results, probes.Checks, b.Metadata.Finished, mode, format, maxTokens)
+}
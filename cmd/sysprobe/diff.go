@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+// runDiff implements the "diff" subcommand
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	outputFile := flags.String("o", "", "Output file path for the change report (default stdout)")
+	context := flags.Int("context", sysprobe.DefaultDiffContext, "Number of unchanged lines shown around each change")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe diff [flags] old.json new.json")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	oldDoc, err := readJSONReport(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", flags.Arg(0), err)
+		os.Exit(1)
+	}
+	newDoc, err := readJSONReport(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", flags.Arg(1), err)
+		os.Exit(1)
+	}
+
+	content, tokenCount, err := sysprobe.Diff(oldDoc, newDoc, *context)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating report: %v\n", err)
+		os.Exit(1)
+	}
+
+	writeOutput(*outputFile, content, tokenCount, "Change report")
+}
+
+// readJSONReport loads a json or jsonl report from disk
+func readJSONReport(path string) (sysprobe.Document, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return sysprobe.Document{}, err
+	}
+	defer file.Close()
+
+	return sysprobe.ReadDocument(file)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/history"
+)
+
+// escalationHelperCommand is the hidden subcommand run as root by --escalate
+const escalationHelperCommand = "escalation-helper"
+
+// auditLogName is the file in the state directory that records every
+// command run as root
+const auditLogName = "escalation.log"
+
+// startEscalation starts the root helper for the privileged tasks among
+// tasks. It returns nil if method is empty, sysprobe already runs as root or
+// no task needs root.
+func startEscalation(method string, plat sysprobe.Platform, tasks []sysprobe.Task) (*sysprobe.Escalator, error) {
+	if method == "" || plat.IsRoot {
+		return nil, nil
+	}
+	privileged := 0
+	for _, t := range tasks {
+		if t.Privilege == "sudo" {
+			privileged++
+		}
+	}
+	if privileged == 0 {
+		return nil, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands run as root are appended to the audit log
+	stateDir, err := history.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return nil, err
+	}
+	auditPath := filepath.Join(stateDir, auditLogName)
+	audit, err := os.OpenFile(auditPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Running %d privileged tasks through %s (logged to %s and the system log)\n", privileged, method, auditPath)
+	return sysprobe.StartEscalation(method, []string{self, escalationHelperCommand}, audit)
+}
+
+// runEscalationHelper implements the helper subcommand. It runs the tasks
+// sent by the parent sysprobe on stdin and writes results to stdout.
+func runEscalationHelper() {
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(os.Stderr, "sysprobe: the escalation helper must run as root")
+		os.Exit(1)
+	}
+
+	// Terminal signals reach the helper too; the parent stops it by closing
+	// stdin, so that results of cancelled tasks are still reported
+	signal.Ignore(os.Interrupt, syscall.SIGTERM)
+
+	// Nothing runs as root unless the system log records it first
+	audit, err := openRootAudit()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sysprobe: escalation helper: cannot open the system log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := sysprobe.ServeEscalation(context.Background(), os.Stdin, os.Stdout, audit); err != nil {
+		fmt.Fprintf(os.Stderr, "sysprobe: escalation helper: %v\n", err)
+		os.Exit(1)
+	}
+}
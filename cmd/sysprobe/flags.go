@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+// listFlag collects comma-separated values from one or more uses of a flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// addSelectorFlags registers the task selection flags on a flag set
+func addSelectorFlags(flags *flag.FlagSet) *sysprobe.Selector {
+	sel := &sysprobe.Selector{}
+	flags.Var((*listFlag)(&sel.Categories), "category", "Only run tasks in these categories (comma-separated, repeatable)")
+	flags.Var((*listFlag)(&sel.Names), "task", "Only run tasks whose name matches a glob or /regex/ (comma-separated, repeatable)")
+	flags.Var((*listFlag)(&sel.Exclude), "exclude", "Skip tasks whose name matches a glob or /regex/ (comma-separated, repeatable)")
+	flags.Var((*listFlag)(&sel.Tags), "tag", "Only run tasks with any of these tags (comma-separated, repeatable)")
+	return sel
+}
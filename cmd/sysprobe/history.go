@@ -0,0 +1,265 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/history"
+)
+
+const historyUsage = `Usage: sysprobe history <command> [flags]
+
+Commands:
+  list              List saved snapshots
+  show <ref>        Render a snapshot as a report
+  diff <ref> [ref]  Show what changed between two snapshots (default: ref → latest)
+  prune             Remove snapshots outside the retention policy
+
+A ref is "latest", a snapshot ID or unique prefix of one (e.g. 20261015),
+or an age such as 24h or 1d meaning the newest snapshot at least that old.
+`
+
+// runHistory implements the "history" subcommand
+func runHistory(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, historyUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		runHistoryList(args[1:])
+	case "show":
+		runHistoryShow(args[1:])
+	case "diff":
+		runHistoryDiff(args[1:])
+	case "prune":
+		runHistoryPrune(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stderr, historyUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown history command: %s\n\n", args[0])
+		fmt.Fprint(os.Stderr, historyUsage)
+		os.Exit(2)
+	}
+}
+
+// runHistoryList prints a table of snapshots
+func runHistoryList(args []string) {
+	flags := flag.NewFlagSet("history list", flag.ExitOnError)
+	historyDir := flags.String("history-dir", "", "Snapshot directory (default $XDG_STATE_HOME/sysprobe/snapshots)")
+	flags.Parse(args)
+
+	store := mustOpenStore(*historyDir)
+	snapshots, err := store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+		os.Exit(1)
+	}
+	if len(snapshots) == 0 {
+		fmt.Printf("No snapshots in %s\n", store.Dir)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tTRIGGER\tOK\tFAILED\tSKIPPED")
+	for _, snap := range snapshots {
+		doc, err := store.Load(snap.ID)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\t-\n", snap.ID, snap.Time.Local().Format(time.DateTime), snap.Trigger)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", snap.ID, snap.Time.Local().Format(time.DateTime), snap.Trigger,
+			doc.Summary.Success, doc.Summary.Failed, doc.Summary.Skipped)
+	}
+	w.Flush()
+}
+
+// runHistoryShow renders a snapshot like a fresh report
+func runHistoryShow(args []string) {
+	flags := flag.NewFlagSet("history show", flag.ExitOnError)
+	historyDir := flags.String("history-dir", "", "Snapshot directory (default $XDG_STATE_HOME/sysprobe/snapshots)")
+	outputFile := flags.String("o", "", "Output file path for the report (default stdout)")
+	minified := flags.Bool("minified", false, "Generate minified output for smaller token count")
+	format := flags.String("format", "markdown", "Report format: markdown, json or jsonl")
+	redactLevel := flags.String("redact", "standard", "Redact addresses, identifiers and secrets: strict, standard or off")
+	maxTokens := flags.Int("max-tokens", 0, "Fit the Markdown report into this many tokens (0 for no limit)")
+	probesDir := flags.String("probes-dir", "", "Additional directory of probe manifests, for task redaction rules and checks")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe history show [flags] <ref>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	reportFormat, err := sysprobe.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	level, err := sysprobe.ParseRedactLevel(*redactLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := mustOpenStore(*historyDir)
+	doc := mustLoadSnapshot(store, flags.Arg(0))
+
+	mode := sysprobe.ModeFull
+	if *minified {
+		mode = sysprobe.ModeMinified
+	}
+
+	// Redaction rules and findings come from the current manifests, as
+	// snapshots are stored unredacted and do not keep findings
+	probes, err := sysprobe.LoadProbes(sysprobe.WithPlatform(doc.Platform), sysprobe.WithProbesDir(*probesDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+
+	results := mustRedact(doc.Results(), probes.Tasks, level)
+	content, tokenCount, err := generateReport(doc.Platform, results, probes.Checks, doc.Generated, mode, reportFormat, *maxTokens)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating report: %v\n", err)
+		os.Exit(1)
+	}
+
+	writeOutput(*outputFile, content, tokenCount, "Report")
+}
+
+// runHistoryDiff renders a change report between two snapshots
+func runHistoryDiff(args []string) {
+	flags := flag.NewFlagSet("history diff", flag.ExitOnError)
+	historyDir := flags.String("history-dir", "", "Snapshot directory (default $XDG_STATE_HOME/sysprobe/snapshots)")
+	outputFile := flags.String("o", "", "Output file path for the change report (default stdout)")
+	context := flags.Int("context", sysprobe.DefaultDiffContext, "Number of unchanged lines shown around each change")
+	redactLevel := flags.String("redact", "standard", "Redact addresses, identifiers and secrets: strict, standard or off")
+	probesDir := flags.String("probes-dir", "", "Additional directory of probe manifests, for task redaction rules")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe history diff [flags] <old-ref> [new-ref]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	newRef := "latest"
+	if flags.NArg() == 2 {
+		newRef = flags.Arg(1)
+	}
+
+	level, err := sysprobe.ParseRedactLevel(*redactLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := mustOpenStore(*historyDir)
+	oldDoc := mustLoadSnapshot(store, flags.Arg(0))
+	newDoc := mustLoadSnapshot(store, newRef)
+
+	probes, err := sysprobe.LoadProbes(sysprobe.WithPlatform(newDoc.Platform), sysprobe.WithProbesDir(*probesDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Both sides are redacted together, so their placeholders are comparable
+	oldResults := oldDoc.Results()
+	results := mustRedact(append(oldResults, newDoc.Results()...), probes.Tasks, level)
+	oldDoc = sysprobe.NewDocument(results[:len(oldResults)], sysprobe.WithPlatform(oldDoc.Platform), sysprobe.WithGenerated(oldDoc.Generated))
+	newDoc = sysprobe.NewDocument(results[len(oldResults):], sysprobe.WithPlatform(newDoc.Platform), sysprobe.WithGenerated(newDoc.Generated))
+
+	content, tokenCount, err := sysprobe.Diff(oldDoc, newDoc, *context)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating report: %v\n", err)
+		os.Exit(1)
+	}
+
+	writeOutput(*outputFile, content, tokenCount, "Change report")
+}
+
+// runHistoryPrune applies a retention policy
+func runHistoryPrune(args []string) {
+	flags := flag.NewFlagSet("history prune", flag.ExitOnError)
+	historyDir := flags.String("history-dir", "", "Snapshot directory (default $XDG_STATE_HOME/sysprobe/snapshots)")
+	keep := flags.Int("keep", DefaultKeep, "Number of snapshots to keep (0 for no limit)")
+	maxAge := flags.String("max-age", DefaultMaxAge, "Remove snapshots older than this, e.g. 72h or 30d (0 for no limit)")
+	flags.Parse(args)
+
+	age, err := history.ParseAge(*maxAge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := mustOpenStore(*historyDir)
+	removed, err := store.Prune(history.Retention{Keep: *keep, MaxAge: age}, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pruning history: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed %d snapshots\n", len(removed))
+}
+
+// mustOpenStore opens the snapshot store or exits
+func mustOpenStore(dir string) *history.Store {
+	store, err := openStore(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening history: %v\n", err)
+		os.Exit(1)
+	}
+	return store
+}
+
+// mustLoadSnapshot resolves a ref and loads its report or exits
+func mustLoadSnapshot(store *history.Store, ref string) sysprobe.Document {
+	snap, err := store.Resolve(ref, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	doc, err := store.Load(snap.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading snapshot %s: %v\n", snap.ID, err)
+		os.Exit(1)
+	}
+	return doc
+}
+
+// mustRedact redacts results with the rules of tasks or exits
+func mustRedact(results []sysprobe.Result, tasks []sysprobe.Task, level sysprobe.RedactLevel) []sysprobe.Result {
+	redacted, err := sysprobe.Redact(results, tasks, sysprobe.WithRedaction(level))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+	return redacted
+}
+
+// writeOutput prints content or saves it to outputFile
+func writeOutput(outputFile, content string, tokenCount int, what string) {
+	if outputFile == "" {
+		fmt.Print(content)
+		return
+	}
+
+	if err := os.WriteFile(outputFile, []byte(content), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ %s saved to: %s (%d tokens)\n", what, outputFile, tokenCount)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// lintTarget is a set of manifests checked together
+type lintTarget struct {
+	source fs.FS
+	dir    string   // how the source is shown in findings
+	files  []string // empty for every manifest in source
+}
+
+// runLint implements the "lint" subcommand
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe lint [paths]")
+		fmt.Fprintln(os.Stderr, "\nChecks manifest files or directories of manifests. Without paths, checks the")
+		fmt.Fprintln(os.Stderr, "embedded manifests and the overlay directories.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	targets, err := lintTargets(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, target := range targets {
+		findings, err := probe.Lint(target.source, target.dir, target.files)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, f := range findings {
+			fmt.Println(f)
+			if f.Severity == probe.SeverityError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+		}
+	}
+
+	if errorCount+warningCount > 0 {
+		fmt.Printf("\n%d errors, %d warnings\n", errorCount, warningCount)
+	}
+	if errorCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// lintTargets returns what to check for the given paths. Each directory is
+// checked as one source, as the loader reads it; files are checked alone.
+func lintTargets(paths []string) ([]lintTarget, error) {
+	if len(paths) == 0 {
+		embedded, err := fs.Sub(sysprobe.ProbeFS, "probes")
+		if err != nil {
+			return nil, err
+		}
+		targets := []lintTarget{{source: embedded, dir: "probes"}}
+		for _, dir := range probe.UserProbeDirs() {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				targets = append(targets, lintTarget{source: os.DirFS(dir), dir: dir})
+			}
+		}
+		return targets, nil
+	}
+
+	var targets []lintTarget
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			targets = append(targets, lintTarget{source: os.DirFS(p), dir: p})
+		} else {
+			dir := filepath.Dir(p)
+			targets = append(targets, lintTarget{source: os.DirFS(dir), dir: dir, files: []string{filepath.Base(p)}})
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+// runList implements the "list" subcommand
+func runList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	probesDir := flags.String("probes-dir", "", "Additional directory of probe manifests (highest precedence)")
+	selector := addSelectorFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe list [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	probes, err := sysprobe.LoadProbes(sysprobe.WithProbesDir(*probesDir), sysprobe.WithSelector(*selector))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+	plat, tasks := probes.Platform, probes.Tasks
+
+	runnable := 0
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CATEGORY\tNAME\tREQUIRES\tTAGS\tRUNNABLE")
+	for _, task := range tasks {
+		status := "yes"
+		if ok, reason := sysprobe.CanRun(task, sysprobe.WithPlatform(plat)); !ok {
+			status = "no: " + reason
+		} else {
+			runnable++
+		}
+
+		requires := strings.Join(task.Requires, ",")
+		if task.Privilege == "sudo" {
+			requires = strings.TrimPrefix(requires+",root", ",")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			task.Category,
+			task.Name,
+			orDash(requires),
+			orDash(strings.Join(task.Tags, ",")),
+			status)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d tasks, %d runnable on %s\n", len(tasks), runnable, plat.DistroID)
+}
+
+// orDash returns s, or "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"sync"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	sysprobe "github.com/pkrzeminski/sysprobe"
-	"github.com/pkrzeminski/sysprobe/internal/platform"
-	"github.com/pkrzeminski/sysprobe/internal/probe"
-	"github.com/pkrzeminski/sysprobe/internal/report"
 	"github.com/pkrzeminski/sysprobe/internal/ui"
 )
 
@@ -18,23 +21,57 @@ var (
 	version = "dev"
 )
 
-// ReportMode indicates which report format to generate
-type ReportMode int
-
-const (
-	ReportFull ReportMode = iota
-	ReportMinified
-	ReportIntro
-)
-
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "list":
+			runList(os.Args[2:])
+			return
+		case "lint":
+			runLint(os.Args[2:])
+			return
+		case "watch":
+			runWatch(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "mcp":
+			runMCP(os.Args[2:])
+			return
+		case escalationHelperCommand:
+			runEscalationHelper()
+			return
+		}
+	}
+
 	// CLI flags
 	outputFile := flag.String("o", "sysprobe-report.md", "Output file path for the report")
 	noUI := flag.Bool("no-ui", false, "Disable interactive UI (print results to stdout)")
 	minified := flag.Bool("minified", false, "Generate minified output for smaller token count")
 	intro := flag.Bool("intro", false, "Generate only system intro for LLM chat context")
 	showVersion := flag.Bool("version", false, "Show version information")
-	workers := flag.Int("workers", 4, "Number of concurrent workers")
+	workers := flag.Int("workers", sysprobe.DefaultWorkers, "Number of concurrent workers")
+	probesDir := flag.String("probes-dir", "", "Additional directory of probe manifests (highest precedence)")
+	format := flag.String("format", "markdown", "Report format: markdown, json or jsonl")
+	redactLevel := flag.String("redact", "standard", "Redact addresses, identifiers and secrets: strict, standard or off")
+	maxTokens := flag.Int("max-tokens", 0, "Fit the Markdown report into this many tokens (0 for no limit)")
+	deadline := flag.Duration("deadline", 0, "Cancel tasks still pending or running after this long, e.g. 2m (0 for no limit)")
+	escalate := flag.String("escalate", "", "Run privileged tasks as root through sudo, pkexec or doas, with one password prompt")
+	recordFile := flag.String("record", "", "Save the output of every command to this fixture file, redacted like the report")
+	replayFile := flag.String("replay", "", "Regenerate the report from a fixture file instead of running commands")
+	bundleFile := flag.String("bundle", "", "Also save a support bundle (.tar.zst) with untruncated output, manifests and reports")
+	selector := addSelectorFlags(flag.CommandLine)
 	flag.Parse()
 
 	if *showVersion {
@@ -43,62 +80,137 @@ func main() {
 	}
 
 	// Determine report mode
-	mode := ReportFull
+	mode := sysprobe.ModeFull
 	if *intro {
-		mode = ReportIntro
+		mode = sysprobe.ModeIntro
 	} else if *minified {
-		mode = ReportMinified
+		mode = sysprobe.ModeMinified
+	}
+
+	reportFormat, err := sysprobe.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *escalate {
+	case "", sysprobe.EscalateSudo, sysprobe.EscalatePkexec, sysprobe.EscalateDoas:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown escalation method: %s\n", *escalate)
+		os.Exit(1)
+	}
+
+	level, err := sysprobe.ParseRedactLevel(*redactLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *replayFile != "" && (*recordFile != "" || *bundleFile != "") {
+		fmt.Fprintln(os.Stderr, "Error: --replay cannot be used with --record or --bundle")
+		os.Exit(1)
 	}
 
-	// Detect platform
-	plat := platform.Detect()
+	// Detect platform, or take it from the fixture being replayed along
+	// with the time it was recorded
+	plat := sysprobe.DetectPlatform()
+	var fixture *sysprobe.Fixture
+	var generated time.Time
+	if *replayFile != "" {
+		fixture, err = sysprobe.LoadFixture(*replayFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		plat = fixture.Platform
+		generated = fixture.Recorded
+	}
 
 	// Load probes
-	loader := probe.NewLoader(sysprobe.ProbeFS, plat)
-	tasks, err := loader.GetAllTasks()
+	probes, err := sysprobe.LoadProbes(sysprobe.WithPlatform(plat), sysprobe.WithProbesDir(*probesDir), sysprobe.WithSelector(*selector))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
 		os.Exit(1)
 	}
+	tasks, checks := probes.Tasks, probes.Checks
 
 	// Filter to intro tasks only if in intro mode
-	if mode == ReportIntro {
-		var introTasks []probe.Task
-		for _, t := range tasks {
-			if t.Category == "intro" {
-				introTasks = append(introTasks, t)
-			}
-		}
-		tasks = introTasks
+	if mode == sysprobe.ModeIntro {
+		tasks = sysprobe.IntroTasks(tasks)
 		// Default output file for intro mode
 		if *outputFile == "sysprobe-report.md" {
 			*outputFile = "sysprobe-intro.md"
 		}
 	}
 
+	// Default output extension follows the format
+	if reportFormat != sysprobe.FormatMarkdown && strings.HasPrefix(*outputFile, "sysprobe-") && strings.HasSuffix(*outputFile, ".md") {
+		*outputFile = strings.TrimSuffix(*outputFile, ".md") + "." + string(reportFormat)
+	}
+
 	if len(tasks) == 0 {
-		fmt.Fprintln(os.Stderr, "No tasks found for this platform")
+		if !selector.IsEmpty() {
+			fmt.Fprintln(os.Stderr, "No tasks match the selection")
+		} else {
+			fmt.Fprintln(os.Stderr, "No tasks found for this platform")
+		}
 		os.Exit(1)
 	}
 
+	// Tasks not finished on SIGINT/SIGTERM or by the deadline are cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runOpts := []sysprobe.Option{
+		sysprobe.WithPlatform(plat),
+		sysprobe.WithWorkers(*workers),
+		sysprobe.WithDeadline(*deadline),
+		sysprobe.WithRedaction(level),
+		sysprobe.WithReplay(fixture),
+	}
+	var recorder *sysprobe.Recorder
+	if *recordFile != "" || *bundleFile != "" {
+		recorder = sysprobe.NewRecorder(plat)
+		runOpts = append(runOpts, sysprobe.WithRecorder(recorder))
+	}
+	if *bundleFile != "" {
+		runOpts = append(runOpts, sysprobe.WithKeepBytes(bundleKeepBytes))
+	}
+
+	// Authenticate once, before the UI takes over the terminal
+	if fixture == nil {
+		escalator, err := startEscalation(*escalate, plat, tasks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if escalator != nil {
+			defer escalator.Close()
+			runOpts = append(runOpts, sysprobe.WithEscalator(escalator))
+		}
+	}
+
+	// The report is dated when the run finishes, unless replayed
+	render := func(results []sysprobe.Result) (string, int, error) {
+		when := generated
+		if when.IsZero() {
+			when = time.Now()
+		}
+		return generateReport(plat, results, checks, when, mode, reportFormat, *maxTokens)
+	}
+
 	// Run with or without UI
+	started := time.Now()
+	var results []sysprobe.Result
 	if *noUI {
-		results := runWithoutUI(plat, tasks, *workers)
-
-		// Generate report
-		rep := report.NewMarkdownReport(plat, results)
-		var content string
-		var tokenCount int
-
-		switch mode {
-		case ReportIntro:
-			content, tokenCount, err = rep.GenerateIntro()
-		case ReportMinified:
-			content, tokenCount, err = rep.GenerateMinified()
-		default:
-			content, tokenCount, err = rep.Generate()
+		results, err = runWithoutUI(ctx, tasks, runOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+			os.Exit(1)
 		}
 
+		// Generate report
+		content, tokenCount, err := render(results)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error generating report: %v\n", err)
 			os.Exit(1)
@@ -110,15 +222,63 @@ func main() {
 			os.Exit(1)
 		}
 
-		fmt.Printf("\n✓ Report saved to: %s (%d tokens)\n", *outputFile, tokenCount)
+		if ctx.Err() != nil {
+			fmt.Printf("\n■ Interrupted. Partial report saved to: %s (%d tokens)\n", *outputFile, tokenCount)
+		} else {
+			fmt.Printf("\n✓ Report saved to: %s (%d tokens)\n", *outputFile, tokenCount)
+		}
 	} else {
 		// UI mode - report is generated inside runWithUI
-		runWithUI(plat, tasks, *workers, *outputFile, mode)
+		results = runWithUI(ctx, tasks, runOpts, render, *outputFile)
+	}
+
+	if *bundleFile != "" {
+		run := bundleRun{
+			probesDir: *probesDir,
+			platform:  plat,
+			results:   results,
+			checks:    checks,
+			recorder:  recorder,
+			redaction: level,
+			started:   started,
+			finished:  time.Now(),
+			mode:      mode,
+			maxTokens: *maxTokens,
+		}
+		if err := writeBundle(*bundleFile, run); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing bundle: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Support bundle saved to: %s\n", *bundleFile)
+	}
+
+	if *recordFile != "" {
+		if err := recorder.Fixture().Save(*recordFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing fixture: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Fixture saved to: %s\n", *recordFile)
+	}
+}
+
+// generateReport renders results collected at the generated time in the
+// requested mode and format, with the findings of checks over them
+func generateReport(plat sysprobe.Platform, results []sysprobe.Result, checks []sysprobe.Check, generated time.Time, mode sysprobe.Mode, format sysprobe.Format, maxTokens int) (string, int, error) {
+	findings, err := sysprobe.EvaluateChecks(checks, results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
+	return sysprobe.Render(results, format,
+		sysprobe.WithPlatform(plat),
+		sysprobe.WithMode(mode),
+		sysprobe.WithFindings(findings),
+		sysprobe.WithGenerated(generated),
+		sysprobe.WithMaxTokens(maxTokens))
 }
 
-// runWithUI runs the diagnostic with the Bubble Tea UI
-func runWithUI(plat platform.Platform, tasks []probe.Task, workerCount int, outputFile string, mode ReportMode) []probe.TaskResult {
+// runWithUI runs the diagnostic with the Bubble Tea UI, writes the report
+// rendered by render and returns the results
+func runWithUI(ctx context.Context, tasks []sysprobe.Task, runOpts []sysprobe.Option, render func([]sysprobe.Result) (string, int, error), outputFile string) []sysprobe.Result {
 	// Create task name list for UI
 	taskNames := make([]string, len(tasks))
 	for i, t := range tasks {
@@ -131,131 +291,120 @@ func runWithUI(plat platform.Platform, tasks []probe.Task, workerCount int, outp
 	// Create program
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
-	// Results channel
-	resultsChan := make(chan probe.TaskResult, len(tasks))
-	var results []probe.TaskResult
-	var resultsMu sync.Mutex
-
-	// Start workers
-	var wg sync.WaitGroup
-	taskChan := make(chan probe.Task, len(tasks))
-
-	// Spawn workers
-	runner := probe.NewRunner(plat)
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for task := range taskChan {
-				// Notify UI that task started
-				p.Send(ui.TaskStartMsg{Name: task.Name})
-
-				// Run task
-				result := runner.Run(task)
-				resultsChan <- result
-
-				// Notify UI that task is done
-				p.Send(ui.TaskDoneMsg{Result: result})
-			}
-		}()
-	}
+	// Quitting the UI stops the run
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Feed tasks
+	// Run tasks and generate report in background
+	type outcome struct {
+		results    []sysprobe.Result
+		tokenCount int
+		err        error
+	}
+	finished := make(chan outcome, 1)
+	tasksDone := make(chan struct{})
 	go func() {
-		for _, task := range tasks {
-			taskChan <- task
+		var results []sysprobe.Result
+		var err error
+		for event := range sysprobe.Run(ctx, tasks, runOpts...) {
+			switch event.Type {
+			case sysprobe.EventStart:
+				p.Send(ui.TaskStartMsg{Name: event.Task.Name})
+			case sysprobe.EventDone:
+				p.Send(ui.TaskDoneMsg{Result: event.Result})
+			case sysprobe.EventFinished:
+				results, err = event.Results, event.Err
+			}
 		}
-		close(taskChan)
-	}()
-
-	// Collect results
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	// Collect all results and generate report in background
-	go func() {
-		for result := range resultsChan {
-			resultsMu.Lock()
-			results = append(results, result)
-			resultsMu.Unlock()
+		close(tasksDone)
+		if err != nil {
+			p.Quit()
+			finished <- outcome{err: err}
+			return
 		}
 		p.Send(ui.AllDoneMsg{Results: results})
 
-		// Generate report in background
-		resultsMu.Lock()
-		resultsCopy := make([]probe.TaskResult, len(results))
-		copy(resultsCopy, results)
-		resultsMu.Unlock()
-
-		rep := report.NewMarkdownReport(plat, resultsCopy)
-		var content string
-		var tokenCount int
-		var err error
-
-		switch mode {
-		case ReportIntro:
-			content, tokenCount, err = rep.GenerateIntro()
-		case ReportMinified:
-			content, tokenCount, err = rep.GenerateMinified()
-		default:
-			content, tokenCount, err = rep.Generate()
+		content, tokenCount, err := render(results)
+		if err == nil {
+			err = os.WriteFile(outputFile, []byte(content), 0644)
 		}
-
 		if err == nil {
-			_ = os.WriteFile(outputFile, []byte(content), 0644)
 			p.Send(ui.ReportDoneMsg{ReportPath: outputFile, TokenCount: tokenCount})
 		}
+		finished <- outcome{results, tokenCount, err}
 	}()
 
 	// Run UI
-	if _, err := p.Run(); err != nil {
+	if _, err := p.Run(); err != nil && !errors.Is(err, tea.ErrInterrupted) {
 		fmt.Fprintf(os.Stderr, "UI error: %v\n", err)
 	}
 
-	return results
+	select {
+	case result := <-finished:
+		if result.err != nil && result.results == nil {
+			fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", result.err)
+			os.Exit(1)
+		}
+		return result.results
+	default:
+	}
+
+	// The UI was closed before the report was written. Tasks still running
+	// are cancelled; either way the report is written from what was
+	// collected.
+	select {
+	case <-tasksDone:
+	default:
+		fmt.Println("Interrupted. Stopping running tasks...")
+		cancel()
+	}
+	result := <-finished
+	if result.err != nil && result.results == nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", result.err)
+		os.Exit(1)
+	}
+	if result.err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", result.err)
+		os.Exit(1)
+	}
+	if slices.ContainsFunc(result.results, func(r sysprobe.Result) bool { return r.Status == sysprobe.StatusCancelled }) {
+		fmt.Printf("■ Partial report saved to: %s (%d tokens)\n", outputFile, result.tokenCount)
+	} else {
+		fmt.Printf("✓ Report saved to: %s (%d tokens)\n", outputFile, result.tokenCount)
+	}
+	return result.results
 }
 
 // runWithoutUI runs diagnostics without the TUI
-func runWithoutUI(plat platform.Platform, tasks []probe.Task, workerCount int) []probe.TaskResult {
+func runWithoutUI(ctx context.Context, tasks []sysprobe.Task, runOpts []sysprobe.Option) ([]sysprobe.Result, error) {
 	fmt.Printf("Running %d diagnostic tasks...\n", len(tasks))
 
-	runner := probe.NewRunner(plat)
-	results := make([]probe.TaskResult, len(tasks))
-
-	// Create work queue
-	taskChan := make(chan int, len(tasks))
-	var wg sync.WaitGroup
-
-	// Spawn workers
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for idx := range taskChan {
-				result := runner.Run(tasks[idx])
-				results[idx] = result
-
-				// Print progress
-				status := "✓"
-				if result.Status == probe.StatusFailed {
-					status = "✗"
-				} else if result.Status == probe.StatusSkipped {
-					status = "⊘"
-				}
-				fmt.Printf("  %s %s\n", status, result.Name)
-			}
-		}()
+	var results []sysprobe.Result
+	var err error
+	for event := range sysprobe.Run(ctx, tasks, runOpts...) {
+		switch event.Type {
+		case sysprobe.EventDone:
+			printProgress(event.Result)
+		case sysprobe.EventFinished:
+			results, err = event.Results, event.Err
+		}
 	}
+	return results, err
+}
 
-	// Feed work
-	for i := range tasks {
-		taskChan <- i
+// printProgress prints a one-line status for a finished task
+func printProgress(result sysprobe.Result) {
+	status := "✓"
+	switch result.Status {
+	case sysprobe.StatusFailed:
+		status = "✗"
+	case sysprobe.StatusSkipped:
+		status = "⊘"
+	case sysprobe.StatusTimedOut:
+		status = "⏱"
+	case sysprobe.StatusCancelled:
+		status = "■"
 	}
-	close(taskChan)
-
-	wg.Wait()
-	return results
+	fmt.Printf("  %s %s\n", status, result.Name)
 }
 
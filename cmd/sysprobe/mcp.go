@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/mcp"
+)
+
+// runMCP implements the "mcp" subcommand, which serves the probes to an LLM
+// client over the Model Context Protocol on stdin and stdout
+func runMCP(args []string) {
+	flags := flag.NewFlagSet("mcp", flag.ExitOnError)
+	probesDir := flags.String("probes-dir", "", "Additional directory of probe manifests (highest precedence)")
+	workers := flags.Int("workers", sysprobe.DefaultWorkers, "Number of concurrent workers per tool call")
+	redactLevel := flags.String("redact", "standard", "Redact addresses, identifiers and secrets: strict, standard or off")
+	deadline := flags.Duration("deadline", 0, "Cancel the tasks of a tool call still pending or running after this long (0 for no limit)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe mcp [flags]")
+		fmt.Fprintln(os.Stderr, "\nServes the loaded tasks over the Model Context Protocol on stdin and stdout.")
+		fmt.Fprintln(os.Stderr, "Meant to be started by an MCP client rather than run by hand.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	level, err := sysprobe.ParseRedactLevel(*redactLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	probes, err := sysprobe.LoadProbes(sysprobe.WithProbesDir(*probesDir))
+	if err == nil && len(probes.Tasks) == 0 {
+		err = errors.New("no tasks found for this platform")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := &mcp.Server{
+		Probes: *probes,
+		Options: []sysprobe.Option{
+			sysprobe.WithWorkers(*workers),
+			sysprobe.WithDeadline(*deadline),
+			sysprobe.WithRedaction(level),
+		},
+		Version: version,
+	}
+
+	// The client ends the session by closing stdin
+	if err := srv.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/server"
+)
+
+// runServe implements the "serve" subcommand, which serves the probes and
+// their reports over HTTP
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8377", "Address to listen on, or unix:<path> for a unix socket")
+	token := flags.String("token", "", "Bearer token clients must send (default $SYSPROBE_TOKEN, or a random one printed at start)")
+	probesDir := flags.String("probes-dir", "", "Additional directory of probe manifests (highest precedence)")
+	workers := flags.Int("workers", sysprobe.DefaultWorkers, "Number of concurrent workers per run")
+	redactLevel := flags.String("redact", "standard", "Redact addresses, identifiers and secrets: strict, standard or off")
+	deadline := flags.Duration("deadline", 0, "Cancel the tasks of a run still pending or running after this long (0 for no limit)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe serve [flags]")
+		fmt.Fprintln(os.Stderr, "\nServes the loaded tasks, runs and reports over HTTP. Every request needs")
+		fmt.Fprintln(os.Stderr, "an \"Authorization: Bearer <token>\" header.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	level, err := sysprobe.ParseRedactLevel(*redactLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *token == "" {
+		*token = os.Getenv("SYSPROBE_TOKEN")
+	}
+	if *token == "" {
+		b := make([]byte, 24)
+		rand.Read(b)
+		*token = hex.EncodeToString(b)
+		fmt.Fprintf(os.Stderr, "Token: %s\n", *token)
+	}
+
+	probes, err := sysprobe.LoadProbes(sysprobe.WithProbesDir(*probesDir))
+	if err == nil && len(probes.Tasks) == 0 {
+		err = errors.New("no tasks found for this platform")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := &server.Server{
+		Probes: *probes,
+		Token:  *token,
+		Options: []sysprobe.Option{
+			sysprobe.WithWorkers(*workers),
+			sysprobe.WithDeadline(*deadline),
+			sysprobe.WithRedaction(level),
+		},
+	}
+	defer srv.Close()
+
+	listener, err := serveListener(*listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	httpServer := &http.Server{
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			httpServer.Close()
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving %d tasks on %s\n", len(probes.Tasks), *listen)
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serveListener listens on a TCP address or, for unix:<path>, on a unix
+// socket only the current user can connect to
+func serveListener(address string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(address, "unix:")
+	if !isUnix {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is reachable from other machines; reports may contain sensitive data\n", address)
+		}
+		return net.Listen("tcp", address)
+	}
+
+	// Replace a socket left behind by an earlier server
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/history"
+	"github.com/pkrzeminski/sysprobe/internal/watch"
+)
+
+// Default retention for snapshots taken by watch
+const (
+	DefaultKeep   = 200
+	DefaultMaxAge = "30d"
+)
+
+// runWatch implements the "watch" subcommand
+func runWatch(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := flags.Duration("interval", 30*time.Minute, "Time between snapshots (0 to only snapshot on triggers)")
+	onResume := flags.Bool("on-resume", true, "Take a snapshot after resume from suspend")
+	onNetwork := flags.Bool("on-network", true, "Take a snapshot after a network change")
+	once := flags.Bool("once", false, "Take a single snapshot and exit (for cron or systemd timers)")
+	workers := flags.Int("workers", sysprobe.DefaultWorkers, "Number of concurrent workers")
+	deadline := flags.Duration("deadline", 10*time.Minute, "Cancel a snapshot's tasks still pending or running after this long (0 for no limit)")
+	probesDir := flags.String("probes-dir", "", "Additional directory of probe manifests (highest precedence)")
+	historyDir := flags.String("history-dir", "", "Snapshot directory (default $XDG_STATE_HOME/sysprobe/snapshots)")
+	keep := flags.Int("keep", DefaultKeep, "Number of snapshots to keep (0 for no limit)")
+	maxAge := flags.String("max-age", DefaultMaxAge, "Remove snapshots older than this, e.g. 72h or 30d (0 for no limit)")
+	selector := addSelectorFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sysprobe watch [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	age, err := history.ParseAge(*maxAge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	retention := history.Retention{Keep: *keep, MaxAge: age}
+
+	store, err := openStore(*historyDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening history: %v\n", err)
+		os.Exit(1)
+	}
+
+	probes, err := sysprobe.LoadProbes(sysprobe.WithProbesDir(*probesDir), sysprobe.WithSelector(*selector))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading probes: %v\n", err)
+		os.Exit(1)
+	}
+	tasks := probes.Tasks
+	if len(tasks) == 0 {
+		fmt.Fprintln(os.Stderr, "No tasks to run")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	snapshot := func(trigger string) {
+		if err := takeSnapshot(ctx, store, tasks, *workers, *deadline, trigger, retention); err != nil {
+			fmt.Fprintf(os.Stderr, "%s snapshot failed: %v\n", time.Now().Format(time.RFC3339), err)
+		}
+	}
+
+	if *once {
+		snapshot(watch.TriggerStart)
+		return
+	}
+
+	fmt.Printf("Watching (%d tasks, interval %s), saving to %s\n", len(tasks), *interval, store.Dir)
+	snapshot(watch.TriggerStart)
+
+	w := watch.New(*interval)
+	w.Resume = *onResume
+	w.Network = *onNetwork
+
+	events := make(chan watch.Event)
+	go w.Run(ctx, events)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			snapshot(event.Trigger)
+		}
+	}
+}
+
+// takeSnapshot runs the tasks, saves the results and applies retention.
+// The platform is detected again as the session may have changed. A run
+// interrupted by ctx is discarded, as its tasks were killed part way.
+// Snapshots are kept unredacted and redacted when they are shown.
+func takeSnapshot(ctx context.Context, store *history.Store, tasks []sysprobe.Task, workerCount int, deadline time.Duration, trigger string, retention history.Retention) error {
+	start := time.Now()
+	plat := sysprobe.DetectPlatform()
+
+	var results []sysprobe.Result
+	var err error
+	for event := range sysprobe.Run(ctx, tasks,
+		sysprobe.WithPlatform(plat),
+		sysprobe.WithWorkers(workerCount),
+		sysprobe.WithDeadline(deadline),
+		sysprobe.WithRedaction(sysprobe.RedactOff)) {
+		if event.Type == sysprobe.EventFinished {
+			results, err = event.Results, event.Err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	doc := sysprobe.NewDocument(results, sysprobe.WithPlatform(plat), sysprobe.WithGenerated(start))
+
+	snap, err := store.Save(doc, trigger)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s saved %s: %d ok, %d failed, %d skipped (%s)\n",
+		start.Format(time.RFC3339), snap.ID,
+		doc.Summary.Success, doc.Summary.Failed, doc.Summary.Skipped,
+		time.Since(start).Round(100*time.Millisecond))
+
+	removed, err := store.Prune(retention, time.Now())
+	if len(removed) > 0 {
+		fmt.Printf("%s removed %d old snapshots\n", time.Now().Format(time.RFC3339), len(removed))
+	}
+	return err
+}
+
+// openStore opens the snapshot store in dir, or in the default location
+func openStore(dir string) (*history.Store, error) {
+	if dir == "" {
+		var err error
+		if dir, err = history.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return history.Open(dir)
+}
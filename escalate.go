@@ -0,0 +1,33 @@
+package sysprobe
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// Escalation methods accepted by StartEscalation
+const (
+	EscalateSudo   = probe.EscalateSudo
+	EscalatePkexec = probe.EscalatePkexec
+	EscalateDoas   = probe.EscalateDoas
+)
+
+// StartEscalation starts helper, a command that calls ServeEscalation, as
+// root through method and waits until it runs, which is when the password
+// prompt, if any, has been answered. Each command run as root is recorded
+// in audit as one JSON line when it starts and when it finishes; audit may
+// be nil, and is closed with the escalator if it is an io.Closer. Pass the
+// escalator to Run with WithEscalator, and close it after the run.
+func StartEscalation(method string, helper []string, audit io.Writer) (*Escalator, error) {
+	return probe.StartEscalation(method, helper, audit)
+}
+
+// ServeEscalation is the helper side of StartEscalation: it runs the tasks
+// requested on in and writes their results to out, until in is closed.
+// Each command is passed to audit before it runs, and does not run if
+// audit returns an error.
+func ServeEscalation(ctx context.Context, in io.Reader, out io.Writer, audit func(task Task, command string) error) error {
+	return probe.NewRunner(DetectPlatform()).ServeEscalation(ctx, in, out, audit)
+}
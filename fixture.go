@@ -0,0 +1,21 @@
+package sysprobe
+
+import "github.com/pkrzeminski/sysprobe/internal/probe"
+
+// NewRecorder creates a recorder for a run on p, to pass to Run with
+// WithRecorder. Once the run has finished, its Fixture method returns what
+// the tasks did, which can be saved and replayed.
+func NewRecorder(p Platform) *Recorder {
+	return probe.NewRecorder(p)
+}
+
+// LoadFixture reads a fixture saved from a Recorder, to pass to Run with
+// WithReplay
+func LoadFixture(path string) (*Fixture, error) {
+	return probe.LoadFixture(path)
+}
+
+// ParseFixture decodes a fixture from the JSON that Fixture.Save writes
+func ParseFixture(data []byte) (*Fixture, error) {
+	return probe.ParseFixture(data)
+}
@@ -0,0 +1,310 @@
+// Package bundle reads and writes support bundles: a zstd-compressed tarball
+// with the recorded output of a run, the manifests it used, its metadata and
+// the rendered reports
+package bundle
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// Version is the version of the bundle layout
+const Version = 1
+
+// Files and directories in a bundle, under rootDir
+const (
+	rootDir      = "sysprobe-bundle"
+	metadataFile = "metadata.json"
+	fixtureFile  = "fixture.json"
+	manifestsDir = "manifests"
+	outputDir    = "output"
+	reportsDir   = "reports"
+)
+
+// Metadata describes the run a bundle was made from
+type Metadata struct {
+	Version    int               `json:"version"`
+	Tool       string            `json:"tool"` // sysprobe version
+	Args       []string          `json:"args"` // command line flags
+	Platform   platform.Platform `json:"platform"`
+	Redaction  string            `json:"redaction"` // level applied to the output and reports
+	Started    time.Time         `json:"started"`
+	Finished   time.Time         `json:"finished"`
+	DurationMS int64             `json:"duration_ms"`
+	Sources    []string          `json:"manifest_sources"` // origin of manifests/1, manifests/2, ...
+	Tasks      []TaskTiming      `json:"tasks"`
+}
+
+// TaskTiming is how one task of the run went
+type TaskTiming struct {
+	Name       string       `json:"name"`
+	Category   string       `json:"category"`
+	Status     probe.Status `json:"status"`
+	Attempts   int          `json:"attempts,omitempty"`
+	DurationMS int64        `json:"duration_ms"`
+	Escalated  string       `json:"escalated,omitempty"`
+}
+
+// NewTaskTimings summarizes task results for the metadata
+func NewTaskTimings(results []probe.TaskResult) []TaskTiming {
+	timings := make([]TaskTiming, len(results))
+	for i, r := range results {
+		timings[i] = TaskTiming{
+			Name:       r.Name,
+			Category:   r.Category,
+			Status:     r.Status,
+			Attempts:   r.Attempts,
+			DurationMS: r.Duration.Milliseconds(),
+			Escalated:  r.Escalated,
+		}
+	}
+	return timings
+}
+
+// Source is a set of manifests, in the order the loader merged them
+type Source struct {
+	Name string // where the manifests came from, e.g. "embedded" or a directory
+	FS   fs.FS
+}
+
+// Bundle is the content of a support bundle
+type Bundle struct {
+	Metadata Metadata
+	Fixture  *probe.Fixture
+	Sources  []Source
+	Reports  map[string]string // file name to content
+}
+
+// Write saves the bundle as a .tar.zst file. Besides the fixture, the last
+// attempt of every task is written as plain stdout and stderr files, so the
+// output can be read without sysprobe.
+func (b *Bundle) Write(file string) (err error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	w := &tarWriter{tw: tw, modTime: b.Metadata.Finished.Truncate(time.Second)}
+	w.json(metadataFile, b.Metadata)
+	if data, err := b.Fixture.Marshal(); err != nil {
+		w.err = err
+	} else {
+		w.file(fixtureFile, data)
+	}
+
+	for i, source := range b.Sources {
+		w.tree(path.Join(manifestsDir, strconv.Itoa(i+1)), source.FS)
+	}
+
+	for _, rec := range b.Fixture.Tasks {
+		if len(rec.Attempts) > 0 {
+			last := rec.Attempts[len(rec.Attempts)-1]
+			w.text(path.Join(outputDir, fileName(rec.Name)+".stdout"), last.Stdout)
+			w.text(path.Join(outputDir, fileName(rec.Name)+".stderr"), last.Stderr)
+		} else if rec.Collection != nil {
+			w.text(path.Join(outputDir, fileName(rec.Name)+".stdout"), rec.Collection.Text)
+		}
+	}
+
+	names := make([]string, 0, len(b.Reports))
+	for name := range b.Reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.file(path.Join(reportsDir, name), []byte(b.Reports[name]))
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// tarWriter writes files under rootDir and keeps the first error
+type tarWriter struct {
+	tw      *tar.Writer
+	modTime time.Time
+	err     error
+}
+
+// file adds a regular file
+func (w *tarWriter) file(name string, data []byte) {
+	if w.err != nil {
+		return
+	}
+	hdr := &tar.Header{
+		Name:    path.Join(rootDir, name),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: w.modTime,
+	}
+	if w.err = w.tw.WriteHeader(hdr); w.err == nil {
+		_, w.err = w.tw.Write(data)
+	}
+}
+
+// text adds a file unless text is empty
+func (w *tarWriter) text(name, text string) {
+	if text != "" {
+		w.file(name, []byte(text))
+	}
+}
+
+// json adds v encoded as indented JSON
+func (w *tarWriter) json(name string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.file(name, append(data, '\n'))
+}
+
+// tree adds every manifest in fsys under dir
+func (w *tarWriter) tree(dir string, fsys fs.FS) {
+	if w.err != nil {
+		return
+	}
+	w.err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".yaml") {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		w.file(path.Join(dir, p), data)
+		return w.err
+	})
+}
+
+// unsafeChars matches runs of characters left out of output file names
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileName turns a task name into a file name, e.g. "Firewall Status
+// (nftables)" into "firewall-status-nftables"
+func fileName(taskName string) string {
+	name := unsafeChars.ReplaceAllString(strings.ToLower(taskName), "-")
+	return strings.Trim(name, "-.")
+}
+
+// Read loads a bundle written by Write. Its manifests are extracted into
+// manifestDir, which the returned sources refer to.
+func Read(file, manifestDir string) (*Bundle, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	defer zr.Close()
+
+	b := &Bundle{Reports: make(map[string]string)}
+	var metadata, fixture []byte
+	sourceDirs := make(map[string]bool)
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := strings.CutPrefix(hdr.Name, rootDir+"/")
+		if !ok || !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("%s: unexpected file %q", file, hdr.Name)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		switch dir, rest, _ := strings.Cut(name, "/"); {
+		case name == metadataFile:
+			metadata = data
+		case name == fixtureFile:
+			fixture = data
+		case dir == reportsDir:
+			b.Reports[rest] = string(data)
+		case dir == manifestsDir:
+			source, _, _ := strings.Cut(rest, "/")
+			sourceDirs[source] = true
+			target := filepath.Join(manifestDir, filepath.FromSlash(rest))
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(target, data, 0600); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if metadata == nil || fixture == nil {
+		return nil, fmt.Errorf("%s: not a sysprobe bundle", file)
+	}
+	if err := json.Unmarshal(metadata, &b.Metadata); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", file, metadataFile, err)
+	}
+	if b.Metadata.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported bundle version %d (want %d)", file, b.Metadata.Version, Version)
+	}
+	if b.Fixture, err = probe.ParseFixture(fixture); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", file, fixtureFile, err)
+	}
+
+	// Sources are numbered from 1 in the order they were merged
+	for i, name := range b.Metadata.Sources {
+		dir := strconv.Itoa(i + 1)
+		if !sourceDirs[dir] {
+			continue
+		}
+		b.Sources = append(b.Sources, Source{Name: name, FS: os.DirFS(filepath.Join(manifestDir, dir))})
+	}
+	if len(b.Sources) == 0 {
+		return nil, errors.New(file + ": bundle has no manifests")
+	}
+	return b, nil
+}
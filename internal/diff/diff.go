@@ -0,0 +1,202 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of a line edit
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is a single line of a line-based diff
+type Edit struct {
+	Op   Op
+	Line string
+}
+
+// Lines computes a minimal line diff between a and b
+func Lines(a, b string) []Edit {
+	oldLines := splitLines(a)
+	newLines := splitLines(b)
+
+	// Trim the common prefix and suffix, which is usually most of the input
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var edits []Edit
+	for _, line := range oldLines[:prefix] {
+		edits = append(edits, Edit{Op: Equal, Line: line})
+	}
+	edits = append(edits, lcs(oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix])...)
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		edits = append(edits, Edit{Op: Equal, Line: line})
+	}
+
+	return edits
+}
+
+// lcs diffs two slices using a longest common subsequence table
+func lcs(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	var edits []Edit
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, Edit{Op: Equal, Line: a[i]})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			edits = append(edits, Edit{Op: Delete, Line: a[i]})
+			i++
+		default:
+			edits = append(edits, Edit{Op: Insert, Line: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, Edit{Op: Delete, Line: a[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, Edit{Op: Insert, Line: b[j]})
+	}
+
+	return edits
+}
+
+// Unified renders a unified diff of a and b with the given number of context
+// lines. It returns an empty string if the inputs are equal.
+func Unified(oldName, newName, a, b string, context int) string {
+	edits := Lines(a, b)
+
+	var out strings.Builder
+	for _, h := range hunks(edits, context) {
+		if out.Len() == 0 {
+			out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+		}
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines)))
+		for _, e := range edits[h.from:h.to] {
+			switch e.Op {
+			case Equal:
+				out.WriteString(" ")
+			case Delete:
+				out.WriteString("-")
+			case Insert:
+				out.WriteString("+")
+			}
+			out.WriteString(e.Line)
+			out.WriteString("\n")
+		}
+	}
+
+	return out.String()
+}
+
+type hunk struct {
+	from, to           int // edit indices
+	oldStart, oldLines int
+	newStart, newLines int
+}
+
+// hunks groups changed edits together with their surrounding context
+func hunks(edits []Edit, context int) []hunk {
+	// Line numbers in the old and new text at which each edit starts
+	oldPos := make([]int, len(edits))
+	newPos := make([]int, len(edits))
+	oldLine, newLine := 1, 1
+	for i, e := range edits {
+		oldPos[i], newPos[i] = oldLine, newLine
+		if e.Op != Insert {
+			oldLine++
+		}
+		if e.Op != Delete {
+			newLine++
+		}
+	}
+
+	var result []hunk
+	var current *hunk
+	lastChange := -1
+
+	for i, e := range edits {
+		if e.Op == Equal {
+			continue
+		}
+
+		if current == nil || i-lastChange-1 > 2*context {
+			if current != nil {
+				closeHunk(current, edits, lastChange+context+1)
+				result = append(result, *current)
+			}
+			start := max(i-context, 0)
+			current = &hunk{from: start, oldStart: oldPos[start], newStart: newPos[start]}
+		}
+		lastChange = i
+	}
+
+	if current != nil {
+		closeHunk(current, edits, lastChange+context+1)
+		result = append(result, *current)
+	}
+
+	return result
+}
+
+// closeHunk sets the end of a hunk and counts its lines
+func closeHunk(h *hunk, edits []Edit, to int) {
+	h.to = min(to, len(edits))
+	for _, e := range edits[h.from:h.to] {
+		if e.Op != Insert {
+			h.oldLines++
+		}
+		if e.Op != Delete {
+			h.newLines++
+		}
+	}
+}
+
+// hunkRange formats a hunk header range
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// splitLines splits text into lines, ignoring a trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
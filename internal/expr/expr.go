@@ -0,0 +1,617 @@
+// Package expr implements the small condition language used by `when:` in
+// probe manifests, e.g. `platform.wm == "hyprland" && !root`.
+//
+// Expressions combine variables, string literals and function calls with
+// ==, !=, <, <=, >, >=, !, && and ||. Ordering comparisons compare strings
+// as versions, so `kernel >= "6.1"` holds for "6.10.2-arch1-1". Variables
+// may also hold numbers, which compare numerically with other numbers and
+// with literals such as 1000000 or 1.5.
+package expr
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Value is the result of evaluating an expression: a string, a float64 or
+// a bool. A variable that is known but not set has the value nil, which
+// equals only the empty string and makes ordering comparisons false.
+type Value any
+
+// Env provides the variables and functions an expression can use
+type Env interface {
+	Var(name string) (Value, bool)
+	Call(name string, args []string) (bool, error)
+}
+
+// Expr is a parsed expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// node is an element of the syntax tree
+type node interface {
+	String() string
+}
+
+type (
+	literal  struct{ value string }
+	variable struct{ name string }
+	call     struct {
+		name string
+		args []node
+	}
+	not    struct{ operand node }
+	binary struct {
+		op          string
+		left, right node
+	}
+)
+
+func (n literal) String() string  { return strconv.Quote(n.value) }
+func (n variable) String() string { return n.name }
+
+func (n not) String() string {
+	if _, ok := n.operand.(binary); ok {
+		return "!(" + n.operand.String() + ")"
+	}
+	return "!" + n.operand.String()
+}
+
+func (n binary) String() string {
+	side := func(child node) string {
+		if b, ok := child.(binary); ok && b.op == "||" && n.op != "||" {
+			return "(" + b.String() + ")"
+		}
+		return child.String()
+	}
+	return side(n.left) + " " + n.op + " " + side(n.right)
+}
+
+func (n call) String() string {
+	args := make([]string, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.String()
+	}
+	return n.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Parse parses an expression
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at column %d", tok, tok.pos+1)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Check verifies that the expression only uses the given variables and
+// functions, and calls functions with the given number of arguments. A nil
+// vars allows any variable, for expressions over data whose keys are only
+// known when they are evaluated.
+func (e *Expr) Check(vars []string, funcs map[string]int) error {
+	var walk func(n node) error
+	walk = func(n node) error {
+		switch n := n.(type) {
+		case variable:
+			if vars == nil {
+				return nil
+			}
+			for _, v := range vars {
+				if v == n.name {
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown variable %s", n.name)
+		case call:
+			arity, ok := funcs[n.name]
+			if !ok {
+				return fmt.Errorf("unknown function %s", n.name)
+			}
+			if len(n.args) != arity {
+				return fmt.Errorf("%s takes %d argument(s), got %d", n.name, arity, len(n.args))
+			}
+			for _, arg := range n.args {
+				if err := walk(arg); err != nil {
+					return err
+				}
+			}
+		case not:
+			return walk(n.operand)
+		case binary:
+			if err := walk(n.left); err != nil {
+				return err
+			}
+			return walk(n.right)
+		}
+		return nil
+	}
+	return walk(e.root)
+}
+
+// Eval evaluates the expression as a condition. When it is false, reason
+// names the part that failed, e.g. `kernel >= "6.1" (kernel is "5.15.0")`.
+func (e *Expr) Eval(env Env) (ok bool, reason string, err error) {
+	return evalBool(e.root, env)
+}
+
+// evalBool evaluates a node that must produce a bool
+func evalBool(n node, env Env) (bool, string, error) {
+	switch n := n.(type) {
+	case binary:
+		switch n.op {
+		case "&&":
+			ok, reason, err := evalBool(n.left, env)
+			if err != nil || !ok {
+				return ok, reason, err
+			}
+			return evalBool(n.right, env)
+		case "||":
+			ok, _, err := evalBool(n.left, env)
+			if err != nil || ok {
+				return ok, "", err
+			}
+			ok, _, err = evalBool(n.right, env)
+			return ok, n.String() + " is false", err
+		}
+		return compare(n, env)
+
+	case not:
+		ok, _, err := evalBool(n.operand, env)
+		return !ok, n.operand.String() + " is true", err
+
+	case call:
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			v, err := evalValue(arg, env)
+			if err != nil {
+				return false, "", err
+			}
+			s, isString := v.(string)
+			if !isString {
+				return false, "", fmt.Errorf("%s: argument %d is not a string", n.name, i+1)
+			}
+			args[i] = s
+		}
+		ok, err := env.Call(n.name, args)
+		if err != nil {
+			return false, "", fmt.Errorf("%s: %w", n, err)
+		}
+		return ok, n.String() + " is false", nil
+	}
+
+	v, err := evalValue(n, env)
+	if err != nil {
+		return false, "", err
+	}
+	b, isBool := v.(bool)
+	if !isBool {
+		return false, "", fmt.Errorf("%s is not a condition", n)
+	}
+	return b, n.String() + " is false", nil
+}
+
+// evalValue evaluates a literal or variable
+func evalValue(n node, env Env) (Value, error) {
+	switch n := n.(type) {
+	case literal:
+		return n.value, nil
+	case variable:
+		v, ok := env.Var(n.name)
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %s", n.name)
+		}
+		return v, nil
+	}
+	ok, _, err := evalBool(n, env)
+	return ok, err
+}
+
+// compare evaluates a comparison
+func compare(n binary, env Env) (bool, string, error) {
+	left, err := evalValue(n.left, env)
+	if err != nil {
+		return false, "", err
+	}
+	right, err := evalValue(n.right, env)
+	if err != nil {
+		return false, "", err
+	}
+
+	var ok bool
+	if left == nil || right == nil {
+		// An unset variable is empty, and neither smaller nor larger than
+		// anything
+		switch n.op {
+		case "==":
+			ok = orEmpty(left) == orEmpty(right)
+		case "!=":
+			ok = orEmpty(left) != orEmpty(right)
+		}
+	} else if l, r, isNumber := numbers(left, right); isNumber {
+		ok = ordered(n.op, cmp.Compare(l, r))
+	} else {
+		switch l := numberString(left).(type) {
+		case bool:
+			r, isBool := right.(bool)
+			if !isBool {
+				return false, "", fmt.Errorf("%s compares a condition with a string", n)
+			}
+			switch n.op {
+			case "==":
+				ok = l == r
+			case "!=":
+				ok = l != r
+			default:
+				return false, "", fmt.Errorf("%s: conditions cannot be ordered", n)
+			}
+		case string:
+			r, isString := numberString(right).(string)
+			if !isString {
+				return false, "", fmt.Errorf("%s compares a string with a condition", n)
+			}
+			switch n.op {
+			case "==":
+				ok = l == r
+			case "!=":
+				ok = l != r
+			default:
+				ok = ordered(n.op, CompareVersions(l, r))
+			}
+		}
+	}
+
+	// Show the actual values of the variables involved
+	reason := n.String()
+	var actual []string
+	for _, side := range []node{n.left, n.right} {
+		if v, isVar := side.(variable); isVar {
+			value, _ := env.Var(v.name)
+			actual = append(actual, fmt.Sprintf("%s is %s", v.name, formatValue(value)))
+		}
+	}
+	if len(actual) > 0 {
+		reason += " (" + strings.Join(actual, ", ") + ")"
+	}
+	return ok, reason, nil
+}
+
+// ordered applies a comparison operator to the result of a three-way
+// comparison
+func ordered(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// numbers returns both values as numbers if one is a number and the other
+// is a number or a string that parses as one
+func numbers(left, right Value) (float64, float64, bool) {
+	l, lok := number(left)
+	r, rok := number(right)
+	_, lnum := left.(float64)
+	_, rnum := right.(float64)
+	return l, r, lok && rok && (lnum || rnum)
+}
+
+// number returns a value as a number, if it is one
+func number(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// numberString formats a number as a string, for comparisons with strings
+// that are not numbers
+func numberString(v Value) Value {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return v
+}
+
+// orEmpty returns the empty string for an unset value
+func orEmpty(v Value) Value {
+	if v == nil {
+		return ""
+	}
+	return numberString(v)
+}
+
+// formatValue formats a value as it would be written in an expression
+func formatValue(v Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "unset"
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(numberString(v))
+}
+
+// versionPart matches the numeric and alphabetic runs of a version
+var versionPart = regexp.MustCompile(`\d+|[A-Za-z]+`)
+
+// CompareVersions compares two version strings part by part, numerically
+// where both parts are numbers. A version that is a prefix of another is
+// smaller, so "6.1" < "6.1.0".
+func CompareVersions(a, b string) int {
+	pa := versionPart.FindAllString(a, -1)
+	pb := versionPart.FindAllString(b, -1)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.ParseUint(pa[i], 10, 64)
+		nb, errB := strconv.ParseUint(pb[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case pa[i] != pb[i]:
+			return strings.Compare(pa[i], pb[i])
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// operators are the operator tokens, longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", ","}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+
+		case c == '"' || c == '\'':
+			// Strings end at the matching quote; \ escapes the next character
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				b.WriteByte(src[j])
+			}
+			if j == len(src) {
+				return nil, fmt.Errorf("unterminated string at column %d", i+1)
+			}
+			tokens = append(tokens, token{tokString, b.String(), i})
+			i = j + 1
+
+		case isIdentByte(c):
+			j := i
+			for j < len(src) && (isIdentByte(src[j]) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, src[i:j], i})
+			i = j
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+// isIdentByte reports whether c may appear in an identifier
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Parser, by precedence from lowest: ||, &&, comparisons, !, operands
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given operator
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return binary{op, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return literal{tok.text}, nil
+
+	case tokIdent:
+		// Unquoted numbers such as 6.1 are strings too
+		if tok.text[0] >= '0' && tok.text[0] <= '9' {
+			return literal{tok.text}, nil
+		}
+		if !p.accept("(") {
+			return variable{tok.text}, nil
+		}
+		c := call{name: tok.text}
+		if p.accept(")") {
+			return c, nil
+		}
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			if p.accept(")") {
+				return c, nil
+			}
+			if !p.accept(",") {
+				tok := p.peek()
+				return nil, fmt.Errorf("expected ',' or ')' but found %s at column %d", tok, tok.pos+1)
+			}
+		}
+
+	case tokOp:
+		if tok.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				tok := p.peek()
+				return nil, fmt.Errorf("expected ')' but found %s at column %d", tok, tok.pos+1)
+			}
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at column %d", tok, tok.pos+1)
+}
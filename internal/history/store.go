@@ -0,0 +1,240 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/report"
+)
+
+// idLayout is the time part of a snapshot ID. IDs sort chronologically.
+const idLayout = "20060102T150405Z"
+
+// Snapshot identifies a report saved in the store
+type Snapshot struct {
+	ID      string // e.g. 20261016T040312Z-interval
+	Time    time.Time
+	Trigger string // what caused the snapshot, e.g. interval or resume
+}
+
+// Retention limits how many snapshots are kept
+type Retention struct {
+	Keep   int           // newest snapshots to keep; 0 means no limit
+	MaxAge time.Duration // drop snapshots older than this; 0 means no limit
+}
+
+// Store keeps snapshots as JSON reports in a directory, one file each
+type Store struct {
+	Dir string
+}
+
+// StateDir returns sysprobe's directory under $XDG_STATE_HOME, falling
+// back to ~/.local/state
+func StateDir() (string, error) {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "sysprobe"), nil
+}
+
+// DefaultDir returns the snapshot directory in the state directory
+func DefaultDir() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "snapshots"), nil
+}
+
+// Open returns the store in dir, creating the directory if needed.
+// Snapshots hold unredacted output, so the directory is private.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Save writes a report as a new snapshot
+func (s *Store) Save(doc report.JSONDocument, trigger string) (Snapshot, error) {
+	snap := Snapshot{
+		ID:      doc.Generated.UTC().Format(idLayout) + "-" + trigger,
+		Time:    doc.Generated.UTC().Truncate(time.Second),
+		Trigger: trigger,
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return snap, err
+	}
+
+	// Write to a temporary file first so a crash never leaves half a snapshot
+	tmp, err := os.CreateTemp(s.Dir, ".snapshot-*")
+	if err != nil {
+		return snap, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return snap, err
+	}
+	if err := tmp.Close(); err != nil {
+		return snap, err
+	}
+
+	path := s.path(snap.ID)
+	if _, err := os.Stat(path); err == nil {
+		return snap, fmt.Errorf("snapshot %s already exists", snap.ID)
+	}
+	return snap, os.Rename(tmp.Name(), path)
+}
+
+// List returns all snapshots, oldest first
+func (s *Store) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		snap, ok := parseID(strings.TrimSuffix(name, ".json"))
+		if !ok {
+			continue
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots, nil
+}
+
+// Load reads the report saved in a snapshot
+func (s *Store) Load(id string) (report.JSONDocument, error) {
+	file, err := os.Open(s.path(id))
+	if err != nil {
+		return report.JSONDocument{}, err
+	}
+	defer file.Close()
+
+	return report.ReadJSON(file)
+}
+
+// Resolve finds a snapshot from a reference, which is one of:
+//   - "latest"
+//   - a snapshot ID, or a unique prefix of one such as 20261015
+//   - an age such as 24h or 2d, meaning the newest snapshot at least that old
+func (s *Store) Resolve(ref string, now time.Time) (Snapshot, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return Snapshot{}, errors.New("no snapshots in " + s.Dir)
+	}
+
+	if ref == "latest" {
+		return snapshots[len(snapshots)-1], nil
+	}
+
+	if age, err := ParseAge(ref); err == nil {
+		cutoff := now.Add(-age)
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			if !snapshots[i].Time.After(cutoff) {
+				return snapshots[i], nil
+			}
+		}
+		return Snapshot{}, fmt.Errorf("no snapshot is older than %s", ref)
+	}
+
+	var matches []Snapshot
+	for _, snap := range snapshots {
+		if snap.ID == ref {
+			return snap, nil
+		}
+		if strings.HasPrefix(snap.ID, ref) {
+			matches = append(matches, snap)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Snapshot{}, fmt.Errorf("no snapshot matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return Snapshot{}, fmt.Errorf("%q matches %d snapshots", ref, len(matches))
+	}
+}
+
+// Prune removes snapshots that fall outside the retention policy and
+// returns them
+func (s *Store) Prune(policy Retention, now time.Time) ([]Snapshot, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Snapshot
+	for i, snap := range snapshots {
+		tooMany := policy.Keep > 0 && i < len(snapshots)-policy.Keep
+		tooOld := policy.MaxAge > 0 && now.Sub(snap.Time) > policy.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(s.path(snap.ID)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, snap)
+	}
+	return removed, nil
+}
+
+// path returns the file holding a snapshot
+func (s *Store) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+// parseID splits a snapshot ID into its time and trigger
+func parseID(id string) (Snapshot, bool) {
+	stamp, trigger, _ := strings.Cut(id, "-")
+	t, err := time.Parse(idLayout, stamp)
+	if err != nil {
+		return Snapshot{}, false
+	}
+	return Snapshot{ID: id, Time: t, Trigger: trigger}, true
+}
+
+// ParseAge parses a duration that may also be given in days, e.g. 30d
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
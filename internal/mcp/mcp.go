@@ -0,0 +1,477 @@
+// Package mcp serves the probes to LLM clients over the Model Context
+// Protocol, so that an assistant can run the diagnostics it needs during a
+// conversation instead of reading a full report.
+//
+// Messages are JSON-RPC 2.0, one per line on stdin and stdout. Every probe
+// category is a tool, run_<category>_probes, taking the names of the tasks
+// to run; list_probes describes them, and the intro report is a resource.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+// protocolVersions are the protocol revisions the server speaks, newest
+// first
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// IntroURI is the resource holding the intro report
+const IntroURI = "sysprobe://report/intro"
+
+// maxMessageBytes bounds a single incoming message
+const maxMessageBytes = 4 << 20
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server answers MCP requests with the loaded tasks. Tasks go through
+// sysprobe.Run, so privileged ones are skipped unless the server runs as
+// root, and results are redacted before they are returned.
+type Server struct {
+	Probes  sysprobe.Probes
+	Options []sysprobe.Option // for every tool call, e.g. sysprobe.WithWorkers, WithDeadline or WithRedaction
+	Version string            // reported to the client
+
+	out     io.Writer
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	inFlight map[string]context.CancelFunc // by request ID
+}
+
+// request is an incoming JSON-RPC request or notification
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is an outgoing JSON-RPC response
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// tool is an MCP tool definition
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// content is a block of a tool result or resource
+type content struct {
+	Type     string `json:"type,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// Serve reads requests from in and writes responses to out until in ends or
+// ctx is done. Requests are handled concurrently, so a long run does not
+// hold up list_probes; notifications/cancelled stops one.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	s.inFlight = make(map[string]context.CancelFunc)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			s.write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			if req.ID != nil {
+				s.write(response{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{codeInvalidRequest, "invalid request"}})
+			}
+			continue
+		}
+		if req.ID == nil {
+			s.notify(req)
+			continue
+		}
+
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.inFlight[string(req.ID)] = reqCancel
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.inFlight, string(req.ID))
+				s.mu.Unlock()
+				reqCancel()
+			}()
+
+			result, err := s.handle(reqCtx, req)
+			resp := response{JSONRPC: "2.0", ID: req.ID, Result: result}
+			if err != nil {
+				rpcErr, ok := err.(*rpcError)
+				if !ok {
+					rpcErr = &rpcError{codeInvalidParams, err.Error()}
+				}
+				resp.Result, resp.Error = nil, rpcErr
+			}
+			// A cancelled request gets no response
+			if reqCtx.Err() == nil || ctx.Err() != nil {
+				s.write(resp)
+			}
+		}()
+	}
+	return scanner.Err()
+}
+
+// write sends a message on its own line
+func (s *Server) write(resp response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(response{JSONRPC: "2.0", ID: resp.ID, Error: &rpcError{codeInvalidRequest, err.Error()}})
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
+
+// notify handles a notification from the client
+func (s *Server) notify(req request) {
+	if req.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(req.Params, &params) != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.inFlight[string(params.RequestID)]; ok {
+		cancel()
+	}
+}
+
+// handle answers a request
+func (s *Server) handle(ctx context.Context, req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := protocolVersions[0]
+		if slices.Contains(protocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities": map[string]any{
+				"tools":     map[string]any{},
+				"resources": map[string]any{},
+			},
+			"serverInfo": map[string]string{"name": "sysprobe", "version": s.Version},
+			"instructions": "Diagnostics of the user's " + s.platformName() + " system. Call list_probes to see the available tasks, " +
+				"then run_<category>_probes with the tasks you need. Results are redacted and privileged tasks are skipped.",
+		}, nil
+
+	case "ping":
+		return struct{}{}, nil
+
+	case "tools/list":
+		return map[string]any{"tools": s.tools()}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		text, err := s.callTool(ctx, params.Name, params.Arguments)
+		if err != nil {
+			// Tool errors are results, so the model can see and correct them
+			return map[string]any{"content": []content{{Type: "text", Text: err.Error()}}, "isError": true}, nil
+		}
+		return map[string]any{"content": []content{{Type: "text", Text: text}}}, nil
+
+	case "resources/list":
+		return map[string]any{"resources": []map[string]string{{
+			"uri":         IntroURI,
+			"name":        "intro",
+			"title":       "System intro",
+			"description": "Concise summary of the system: hardware, distribution, key software versions and current issues",
+			"mimeType":    "text/markdown",
+		}}}, nil
+
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		if params.URI != IntroURI {
+			return nil, &rpcError{codeInvalidParams, "unknown resource " + params.URI}
+		}
+		text, err := s.intro(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"contents": []content{{URI: IntroURI, MimeType: "text/markdown", Text: text}}}, nil
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
+
+// tools returns list_probes and a run tool for every category
+func (s *Server) tools() []tool {
+	tools := []tool{{
+		Name:        "list_probes",
+		Description: "List the diagnostic tasks on this system by category, with whether each can run and why not",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"category": map[string]any{"type": "string", "enum": s.categories(), "description": "Only list this category"},
+			},
+		},
+	}}
+
+	for _, category := range s.categories() {
+		names := s.taskNames(category)
+		tools = append(tools, tool{
+			Name: toolName(category),
+			Description: fmt.Sprintf("Run %s diagnostics and return their output as Markdown, with findings first. Tasks: %s",
+				category, strings.Join(names, ", ")),
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"tasks": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string", "enum": names},
+						"description": "Tasks to run; every task of the category if omitted",
+					},
+					"max_tokens": map[string]any{"type": "integer", "minimum": 0, "description": "Fit the output into this many tokens"},
+				},
+			},
+		})
+	}
+	return tools
+}
+
+// callTool runs a tool and returns its text
+func (s *Server) callTool(ctx context.Context, name string, arguments json.RawMessage) (string, error) {
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage("{}")
+	}
+
+	if name == "list_probes" {
+		var args struct {
+			Category string `json:"category"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", err
+		}
+		return s.listProbes(args.Category)
+	}
+
+	category, ok := s.toolCategory(name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", name)
+	}
+	var args struct {
+		Tasks     []string `json:"tasks"`
+		MaxTokens int      `json:"max_tokens"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", err
+	}
+
+	var selected []sysprobe.Task
+	for _, task := range s.Probes.Tasks {
+		if task.Category == category && (len(args.Tasks) == 0 || slices.Contains(args.Tasks, task.Name)) {
+			selected = append(selected, task)
+		}
+	}
+	for _, name := range args.Tasks {
+		if !slices.ContainsFunc(selected, func(t sysprobe.Task) bool { return t.Name == name }) {
+			return "", fmt.Errorf("no task %q in %s (tasks: %s)", name, category, strings.Join(s.taskNames(category), ", "))
+		}
+	}
+
+	results, err := s.run(ctx, sysprobe.AddDependencies(s.Probes.Tasks, selected))
+	if err != nil {
+		return "", err
+	}
+	text, _, err := s.render(results, sysprobe.ModeMinified, max(args.MaxTokens, 0))
+	return text, err
+}
+
+// listProbes describes the tasks, grouped by category
+func (s *Server) listProbes(only string) (string, error) {
+	if only != "" && !slices.Contains(s.categories(), only) {
+		return "", fmt.Errorf("unknown category %q (categories: %s)", only, strings.Join(s.categories(), ", "))
+	}
+
+	var b strings.Builder
+	for _, category := range s.categories() {
+		if only != "" && category != only {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s (tool %s)\n", category, toolName(category))
+		for _, task := range s.Probes.Tasks {
+			if task.Category != category {
+				continue
+			}
+			if ok, reason := sysprobe.CanRun(task, sysprobe.WithPlatform(s.Probes.Platform)); ok {
+				fmt.Fprintf(&b, "- %s\n", task.Name)
+			} else {
+				fmt.Fprintf(&b, "- %s (cannot run: %s)\n", task.Name, reason)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// intro runs the intro tasks and renders the intro report
+func (s *Server) intro(ctx context.Context) (string, error) {
+	results, err := s.run(ctx, sysprobe.IntroTasks(s.Probes.Tasks))
+	if err != nil {
+		return "", err
+	}
+	text, _, err := s.render(results, sysprobe.ModeIntro, 0)
+	return text, err
+}
+
+// run runs tasks and returns their redacted results. A call cancelled by
+// the client returns an error instead.
+func (s *Server) run(ctx context.Context, tasks []sysprobe.Task) ([]sysprobe.Result, error) {
+	opts := append([]sysprobe.Option{sysprobe.WithPlatform(s.Probes.Platform)}, s.Options...)
+	var results []sysprobe.Result
+	var err error
+	for event := range sysprobe.Run(ctx, tasks, opts...) {
+		if event.Type == sysprobe.EventFinished {
+			results, err = event.Results, event.Err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	return results, err
+}
+
+// render renders a Markdown report of results with the findings of the
+// checks
+func (s *Server) render(results []sysprobe.Result, mode sysprobe.Mode, maxTokens int) (string, int, error) {
+	findings, err := sysprobe.EvaluateChecks(s.Probes.Checks, results)
+	if err != nil {
+		// stdout carries the protocol, the log goes to stderr
+		log.Printf("checks: %v", err)
+	}
+	return sysprobe.Render(results, sysprobe.FormatMarkdown,
+		sysprobe.WithPlatform(s.Probes.Platform),
+		sysprobe.WithMode(mode),
+		sysprobe.WithFindings(findings),
+		sysprobe.WithMaxTokens(maxTokens))
+}
+
+// categories returns the categories of the tasks, sorted
+func (s *Server) categories() []string {
+	var categories []string
+	for _, task := range s.Probes.Tasks {
+		if !slices.Contains(categories, task.Category) {
+			categories = append(categories, task.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// taskNames returns the names of the tasks in a category
+func (s *Server) taskNames(category string) []string {
+	var names []string
+	for _, task := range s.Probes.Tasks {
+		if task.Category == category {
+			names = append(names, task.Name)
+		}
+	}
+	return names
+}
+
+// toolCategory returns the category a run tool is named after
+func (s *Server) toolCategory(name string) (string, bool) {
+	for _, category := range s.categories() {
+		if toolName(category) == name {
+			return category, true
+		}
+	}
+	return "", false
+}
+
+// platformName names the platform for the client's instructions
+func (s *Server) platformName() string {
+	name := s.Probes.Platform.Distro
+	if name == "" {
+		name = s.Probes.Platform.OS
+	}
+	if s.Probes.Platform.WM != "" {
+		name += " (" + s.Probes.Platform.WM + ")"
+	}
+	return name
+}
+
+// toolName returns the name of the tool running a category. Tool names
+// may only contain letters, digits, underscores and dashes.
+func toolName(category string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(category))
+	return "run_" + name + "_probes"
+}
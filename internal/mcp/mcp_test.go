@@ -0,0 +1,246 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+	"github.com/pkrzeminski/sysprobe/internal/report"
+)
+
+// newServer returns a server with a long storage task, a privileged one, an
+// intro task and a logs task that runs until it is cancelled
+func newServer() *Server {
+	return &Server{
+		Probes: sysprobe.Probes{
+			Platform: sysprobe.Platform{OS: "linux", Distro: "fedora"},
+			Tasks: []sysprobe.Task{
+				{Name: "Block Devices", Command: `for i in $(seq 1 400); do echo "loop$i 7:$i 0 55.7M 1 loop /snap/core/$i"; done`, Category: "storage"},
+				{Name: "Firmware Updates", Command: "fwupdmgr get-updates", Category: "storage", Privilege: "sudo"},
+				{Name: "Follow Journal", Command: "tail -f /dev/null", Category: "logs"},
+				{Name: "Distribution", Command: "echo 'Fedora Linux 40 (Workstation Edition)'", Category: "intro"},
+			},
+			Checks: []sysprobe.Check{
+				{Name: "snap-loops", Task: "Block Devices", If: `lines > 100`, Severity: probe.IssueInfo, Message: "{{lines}} loop devices from snaps"},
+			},
+		},
+		Options: []sysprobe.Option{sysprobe.WithWorkers(2)},
+		Version: "test",
+	}
+}
+
+// reply is a response as the client reads it
+type reply struct {
+	Result *struct {
+		ProtocolVersion string            `json:"protocolVersion"`
+		ServerInfo      map[string]string `json:"serverInfo"`
+		Tools           []tool            `json:"tools"`
+		Resources       []map[string]string
+		Content         []content
+		Contents        []content
+		IsError         bool `json:"isError"`
+	}
+	Error *rpcError
+}
+
+// text returns the text of a tool result
+func (r reply) text() string {
+	if r.Result == nil || len(r.Result.Content) == 0 {
+		return ""
+	}
+	return r.Result.Content[0].Text
+}
+
+// session sends lines to a new server and returns the responses by ID.
+// Requests are handled concurrently, so responses come in any order.
+func session(t *testing.T, lines ...string) map[string]reply {
+	t.Helper()
+	var out bytes.Buffer
+	if err := newServer().Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")), &out); err != nil {
+		t.Fatal(err)
+	}
+	return parseReplies(t, out.String())
+}
+
+// parseReplies reads responses, one per line
+func parseReplies(t *testing.T, out string) map[string]reply {
+	t.Helper()
+	replies := map[string]reply{}
+	for line := range strings.Lines(out) {
+		var resp struct {
+			ID json.RawMessage
+			reply
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		replies[string(resp.ID)] = resp.reply
+	}
+	return replies
+}
+
+func TestServe(t *testing.T) {
+	t.Run("initialize", func(t *testing.T) {
+		replies := session(t,
+			`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2024-11-05", "capabilities": {}}}`,
+			`{"jsonrpc": "2.0", "id": 2, "method": "initialize", "params": {"protocolVersion": "1999-01-01"}}`,
+			`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+			`not json`,
+			`{"jsonrpc": "1.0", "id": 3, "method": "ping"}`,
+			`{"jsonrpc": "2.0", "id": 4, "method": "sampling/createMessage"}`,
+		)
+		if len(replies) != 5 {
+			t.Errorf("got %d responses, want 5 (notifications get none): %+v", len(replies), replies)
+		}
+		if r := replies["1"].Result; r == nil || r.ProtocolVersion != "2024-11-05" || r.ServerInfo["version"] != "test" {
+			t.Errorf("initialize: %+v", r)
+		}
+		if r := replies["2"].Result; r == nil || r.ProtocolVersion != protocolVersions[0] {
+			t.Errorf("unsupported version: %+v", r)
+		}
+
+		for id, code := range map[string]int{"null": codeParseError, "3": codeInvalidRequest, "4": codeMethodNotFound} {
+			if err := replies[id].Error; err == nil || err.Code != code {
+				t.Errorf("response %s: error %+v, want code %d", id, err, code)
+			}
+		}
+	})
+
+	t.Run("tools/list", func(t *testing.T) {
+		replies := session(t, `{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`)
+		var names []string
+		for _, tool := range replies["1"].Result.Tools {
+			names = append(names, tool.Name)
+		}
+		if got := strings.Join(names, " "); got != "list_probes run_intro_probes run_logs_probes run_storage_probes" {
+			t.Errorf("tools: %s", got)
+		}
+	})
+
+	t.Run("call", func(t *testing.T) {
+		counter, err := report.NewTokenCounter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name      string
+			params    string
+			isError   bool
+			contains  []string
+			omits     []string
+			maxTokens int
+		}{
+			{
+				name:     "list storage",
+				params:   `{"name": "list_probes", "arguments": {"category": "storage"}}`,
+				contains: []string{"- Block Devices\n", "- Firmware Updates (cannot run:"},
+				omits:    []string{"Follow Journal"},
+			},
+			{
+				name:     "selected task",
+				params:   `{"name": "run_storage_probes", "arguments": {"tasks": ["Block Devices"]}}`,
+				contains: []string{"/snap/core/400\n", "400 loop devices from snaps"},
+			},
+			{
+				// The budget keeps the finding and cuts the long output
+				name:      "max_tokens",
+				params:    `{"name": "run_storage_probes", "arguments": {"max_tokens": 300}}`,
+				contains:  []string{"400 loop devices from snaps"},
+				omits:     []string{"/snap/core/400\n"},
+				maxTokens: 300,
+			},
+			{
+				name:     "unknown task",
+				params:   `{"name": "run_storage_probes", "arguments": {"tasks": ["lsblk; reboot"]}}`,
+				isError:  true,
+				contains: []string{`no task "lsblk; reboot" in storage`},
+			},
+			{
+				name:     "unknown category",
+				params:   `{"name": "list_probes", "arguments": {"category": "gpu"}}`,
+				isError:  true,
+				contains: []string{`unknown category "gpu"`},
+			},
+			{
+				name:     "unknown tool",
+				params:   `{"name": "run_gpu_probes"}`,
+				isError:  true,
+				contains: []string{`unknown tool "run_gpu_probes"`},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := session(t, `{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": `+tt.params+`}`)["1"]
+				text := r.text()
+				if r.Result == nil || r.Result.IsError != tt.isError {
+					t.Fatalf("result %+v, error %+v", r.Result, r.Error)
+				}
+				for _, s := range tt.contains {
+					if !strings.Contains(text, s) {
+						t.Errorf("missing %q:\n%s", s, text)
+					}
+				}
+				for _, s := range tt.omits {
+					if strings.Contains(text, s) {
+						t.Errorf("has %q:\n%s", s, text)
+					}
+				}
+				if tokens := counter.Count(text); tt.maxTokens > 0 && tokens > tt.maxTokens {
+					t.Errorf("%d tokens, want at most %d", tokens, tt.maxTokens)
+				}
+			})
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		// A call the client cancels gets no response, and the others
+		// are answered
+		replies := session(t,
+			`{"jsonrpc": "2.0", "id": "slow", "method": "tools/call", "params": {"name": "run_logs_probes"}}`,
+			`{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": "slow", "reason": "user went away"}}`,
+			`{"jsonrpc": "2.0", "id": 1, "method": "ping"}`,
+		)
+		if _, ok := replies[`"slow"`]; ok || replies["1"].Result == nil {
+			t.Errorf("responses: %+v", replies)
+		}
+
+		// A call still running when the session ends fails
+		ctx, cancel := context.WithCancel(context.Background())
+		in, w := io.Pipe()
+		var out bytes.Buffer
+		served := make(chan error)
+		go func() { served <- newServer().Serve(ctx, in, &out) }()
+		io.WriteString(w, `{"jsonrpc": "2.0", "id": "slow", "method": "tools/call", "params": {"name": "run_logs_probes"}}`+"\n")
+		cancel()
+		w.Close()
+		if err := <-served; err != nil {
+			t.Fatal(err)
+		}
+		if r := parseReplies(t, out.String())[`"slow"`]; r.Result == nil || !r.Result.IsError || r.text() != context.Canceled.Error() {
+			t.Errorf("call when the session ended: %+v", r)
+		}
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		replies := session(t,
+			`{"jsonrpc": "2.0", "id": 1, "method": "resources/list"}`,
+			`{"jsonrpc": "2.0", "id": 2, "method": "resources/read", "params": {"uri": "sysprobe://report/intro"}}`,
+			`{"jsonrpc": "2.0", "id": 3, "method": "resources/read", "params": {"uri": "sysprobe://report/full"}}`,
+		)
+		if r := replies["1"].Result; r == nil || len(r.Resources) != 1 || r.Resources[0]["uri"] != IntroURI {
+			t.Errorf("resources: %+v", r)
+		}
+		if r := replies["2"].Result; r == nil || len(r.Contents) != 1 || !strings.Contains(r.Contents[0].Text, "Fedora Linux 40") ||
+			strings.Contains(r.Contents[0].Text, "Block Devices") {
+			t.Errorf("intro resource: %+v", r)
+		}
+		if err := replies["3"].Error; err == nil || err.Code != codeInvalidParams {
+			t.Errorf("unknown resource: %+v", err)
+		}
+	})
+}
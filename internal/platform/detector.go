@@ -9,33 +9,46 @@ import (
 
 // Platform holds detected system information
 type Platform struct {
-	OS        string // e.g., "linux", "darwin", "windows"
-	Distro    string // e.g., "arch", "ubuntu", "fedora"
-	DistroID  string // e.g., "arch_linux"
-	WM        string // e.g., "hyprland", "sway", "gnome"
-	IsRoot    bool
-	IsWayland bool
+	OS        string   `json:"os"`               // e.g., "linux", "darwin", "windows"
+	Arch      string   `json:"arch"`             // CPU architecture, e.g., "amd64", "arm64"
+	Distro    string   `json:"distro"`           // os-release ID, e.g., "arch", "ubuntu", "fedora"
+	DistroID  string   `json:"distro_id"`        // e.g., "arch_linux"
+	IDLike    []string `json:"id_like"`          // os-release ID_LIKE, closest parent first, e.g., ["ubuntu", "debian"]
+	VersionID string   `json:"version_id"`       // os-release VERSION_ID, e.g., "24.04"; empty on rolling releases
+	Kernel    string   `json:"kernel,omitempty"` // kernel release, e.g., "6.9.7-arch1-1"
+	WM        string   `json:"wm"`               // e.g., "hyprland", "sway", "gnome"
+	IsRoot    bool     `json:"is_root"`
+	IsWayland bool     `json:"is_wayland"`
 }
 
 // Detect returns information about the current platform
 func Detect() Platform {
 	p := Platform{
 		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
 		IsRoot: os.Geteuid() == 0,
 	}
 
 	// Parse /etc/os-release for distro info
 	if osRelease, err := parseOSRelease(); err == nil {
-		p.Distro = osRelease["ID"]
-		p.DistroID = osRelease["ID"]
-		if idLike, ok := osRelease["ID_LIKE"]; ok && p.Distro == "" {
-			p.Distro = idLike
+		p.Distro = strings.ToLower(osRelease["ID"])
+		p.IDLike = strings.Fields(strings.ToLower(osRelease["ID_LIKE"]))
+		p.VersionID = osRelease["VERSION_ID"]
+
+		// Fall back to the closest parent if the distro has no ID of its own
+		if p.Distro == "" && len(p.IDLike) > 0 {
+			p.Distro = p.IDLike[0]
 		}
 	}
 
+	// Kernel release, as printed by uname -r
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		p.Kernel = strings.TrimSpace(string(release))
+	}
+
 	// Normalize distro ID
-	if p.DistroID != "" {
-		p.DistroID = strings.ToLower(p.DistroID) + "_linux"
+	if p.Distro != "" {
+		p.DistroID = p.Distro + "_linux"
 	}
 
 	// Detect display server
@@ -49,6 +62,33 @@ func Detect() Platform {
 	return p
 }
 
+// normalizeID lowercases a platform identifier and strips the legacy
+// "_linux" suffix, so "Arch_Linux" and "arch" compare equal
+func normalizeID(id string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(id)), "_linux")
+}
+
+// Is reports whether the platform is exactly the given distro
+func (p Platform) Is(id string) bool {
+	return p.Distro != "" && normalizeID(id) == p.Distro
+}
+
+// IsLike reports whether the platform is the given distro or derives from
+// it according to ID_LIKE (e.g., EndeavourOS and Manjaro are like "arch")
+func (p Platform) IsLike(id string) bool {
+	if p.Is(id) {
+		return true
+	}
+
+	id = normalizeID(id)
+	for _, parent := range p.IDLike {
+		if parent == id {
+			return true
+		}
+	}
+	return false
+}
+
 // parseOSRelease reads and parses /etc/os-release
 func parseOSRelease() (map[string]string, error) {
 	file, err := os.Open("/etc/os-release")
@@ -107,6 +147,15 @@ func detectWM() string {
 	return ""
 }
 
+// KnownTags are the task tags MatchesTags is meant for: display servers,
+// window managers and desktops, and distro families. Other tags still match
+// a distro family or a WM by name, but are likely typos.
+var KnownTags = []string{
+	"wayland", "x11",
+	"hyprland", "sway", "niri", "river", "i3", "gnome", "kde", "plasma", "xfce", "cinnamon", "mate", "lxqt", "budgie",
+	"arch", "debian", "ubuntu", "fedora", "rhel", "suse", "opensuse",
+}
+
 // MatchesTags checks if the platform matches any of the given tags
 func (p Platform) MatchesTags(tags []string) bool {
 	if len(tags) == 0 {
@@ -141,8 +190,8 @@ func (p Platform) MatchesTags(tags []string) bool {
 				return true
 			}
 		default:
-			// Generic match against distro or WM
-			if strings.Contains(p.Distro, tag) || strings.Contains(p.WM, tag) {
+			// Generic match against distro family or WM
+			if p.IsLike(tag) || strings.Contains(p.WM, tag) {
 				return true
 			}
 		}
@@ -0,0 +1,266 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkrzeminski/sysprobe/internal/expr"
+)
+
+// Check is a health rule from the `checks:` section of a manifest. It looks
+// at the result of one task and reports an Issue when its condition holds.
+type Check struct {
+	Name     string `yaml:"name"`
+	Task     string `yaml:"task"`               // name of the task whose result is checked
+	If       string `yaml:"if,omitempty"`       // condition over the task's fields and output; one issue when it holds
+	Each     string `yaml:"each,omitempty"`     // condition over each parsed record; one issue per matching record
+	Severity string `yaml:"severity"`           // critical, warning or info
+	Message  string `yaml:"message"`            // what is wrong; {{key}} is replaced by a field of the record or task
+	Hint     string `yaml:"hint,omitempty"`     // how to fix it, with the same placeholders
+	Disabled bool   `yaml:"disabled,omitempty"` // removes a check of the same name from an earlier source
+}
+
+// Values of Check.Severity, most serious first
+const (
+	IssueCritical = "critical"
+	IssueWarning  = "warning"
+	IssueInfo     = "info"
+)
+
+// checkSeverities orders the severities for reports
+var checkSeverities = []string{IssueCritical, IssueWarning, IssueInfo}
+
+// checkFuncs are the functions available to check conditions, with their
+// number of arguments. Variables are the keys of the record or fields, and
+// lines, the number of lines of output.
+var checkFuncs = map[string]int{
+	"contains": 1, // the output contains a string
+	"matches":  1, // a line of the output matches a regular expression
+}
+
+// Issue is a problem found by a check
+type Issue struct {
+	Check    string `json:"check"`
+	Task     string `json:"task"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// placeholder matches {{key}} in messages and hints
+var placeholder = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// validate checks the fields of a check that the YAML decoder cannot
+func (c Check) validate() error {
+	if c.Name == "" {
+		return errors.New("check has no name")
+	}
+	if c.Disabled {
+		return nil
+	}
+	if c.Task == "" {
+		return fmt.Errorf("check %q: no task", c.Name)
+	}
+	if (c.If == "") == (c.Each == "") {
+		return fmt.Errorf("check %q: want exactly one of if and each", c.Name)
+	}
+	if _, err := c.condition(); err != nil {
+		return fmt.Errorf("check %q: %w", c.Name, err)
+	}
+	if !slices.Contains(checkSeverities, c.Severity) {
+		return fmt.Errorf("check %q: invalid severity %q (want %s)", c.Name, c.Severity, strings.Join(checkSeverities, ", "))
+	}
+	if c.Message == "" {
+		return fmt.Errorf("check %q: no message", c.Name)
+	}
+	return nil
+}
+
+// condition parses and checks the check's if or each expression
+func (c Check) condition() (*expr.Expr, error) {
+	key, src := "if", c.If
+	if c.Each != "" {
+		key, src = "each", c.Each
+	}
+	e, err := expr.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	if err := e.Check(nil, checkFuncs); err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return e, nil
+}
+
+// EvaluateChecks runs checks over the successful results of their tasks.
+// Issues are ordered by severity, then by check and record. Checks that
+// cannot be evaluated, such as one comparing a string with a condition,
+// are reported in the error and do not stop the others.
+func EvaluateChecks(checks []Check, results []TaskResult) ([]Issue, error) {
+	byTask := make(map[string]TaskResult, len(results))
+	for _, result := range results {
+		if result.Status == StatusSuccess {
+			byTask[result.Name] = result
+		}
+	}
+
+	var issues []Issue
+	var errs []error
+	for _, check := range checks {
+		result, ok := byTask[check.Task]
+		if !ok || check.Disabled {
+			continue
+		}
+		found, err := check.evaluate(result)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("check %q: %w", check.Name, err))
+			continue
+		}
+		issues = append(issues, found...)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return slices.Index(checkSeverities, issues[i].Severity) < slices.Index(checkSeverities, issues[j].Severity)
+	})
+	return issues, errors.Join(errs...)
+}
+
+// evaluate applies a check to the result of its task
+func (c Check) evaluate(result TaskResult) ([]Issue, error) {
+	cond, err := c.condition()
+	if err != nil {
+		return nil, err
+	}
+	env := checkEnv{fields: result.Fields, output: result.Output}
+
+	if c.If != "" {
+		return c.match(cond, env)
+	}
+	var issues []Issue
+	for _, record := range result.Records {
+		env.record = record
+		found, err := c.match(cond, env)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// match returns an issue if the condition holds in env
+func (c Check) match(cond *expr.Expr, env checkEnv) ([]Issue, error) {
+	ok, _, err := cond.Eval(env)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []Issue{{
+		Check:    c.Name,
+		Task:     c.Task,
+		Severity: c.Severity,
+		Message:  env.expand(c.Message),
+		Hint:     env.expand(c.Hint),
+	}}, nil
+}
+
+// checkEnv evaluates check conditions against a task result and, for
+// `each:`, one of its records
+type checkEnv struct {
+	record Record
+	fields Record
+	output string
+}
+
+// Var returns a key of the record, then of the fields: a float64 for
+// numbers, a bool for flags and a string otherwise. Missing keys are unset,
+// so that they equal only "" and ordering comparisons with them are false
+// rather than errors.
+func (c checkEnv) Var(name string) (expr.Value, bool) {
+	value, ok := c.lookup(name)
+	if !ok {
+		return nil, true
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return checkValue(value), true
+}
+
+// lookup returns a key of the record, then of the fields, or the number of
+// lines of output
+func (c checkEnv) lookup(name string) (any, bool) {
+	for _, r := range []Record{c.record, c.fields} {
+		if value, ok := r[name]; ok && value != nil {
+			return value, true
+		}
+	}
+	if name == "lines" {
+		return len(outputLines(c.output)), true
+	}
+	return nil, false
+}
+
+// Call evaluates a check function
+func (c checkEnv) Call(name string, args []string) (bool, error) {
+	switch name {
+	case "contains":
+		return strings.Contains(c.output, args[0]), nil
+	case "matches":
+		re, err := regexp.Compile("(?m)" + args[0])
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(c.output), nil
+	}
+	return false, fmt.Errorf("unknown function")
+}
+
+// expand replaces the placeholders in text with values from the record and
+// fields
+func (c checkEnv) expand(text string) string {
+	return placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		value, ok := c.lookup(placeholder.FindStringSubmatch(m)[1])
+		if !ok {
+			return ""
+		}
+		return checkValue(value)
+	})
+}
+
+// checkValue formats a field value for comparisons with strings and for
+// messages, without exponents for large numbers
+func checkValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// outputLines returns the non-empty lines of a task's output, without the
+// note added when it was truncated
+func outputLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "... [truncated") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,92 @@
+package probe
+
+import "testing"
+
+// TestEvaluateChecks checks conditions over records, fields and output,
+// placeholders in messages and the order of issues
+func TestEvaluateChecks(t *testing.T) {
+	results := []TaskResult{
+		{
+			Name:   "Disks",
+			Status: StatusSuccess,
+			Records: []Record{
+				{"mount": "/", "use_percent": int64(43)},
+				{"mount": "/home", "use_percent": 95.0}, // as decoded from a JSON report
+				{"mount": "/snap/core", "use_percent": int64(100), "type": "squashfs"},
+			},
+		},
+		{
+			Name:   "Sysctl",
+			Status: StatusSuccess,
+			Output: "a = 1\nb = 2\n",
+			Fields: Record{"a": int64(1), "b": int64(2), "up": true},
+		},
+		{
+			Name:   "Pools",
+			Status: StatusSuccess,
+			Records: []Record{
+				{"pool": "tank", "ratio": 1.05, "avail_bytes": uint64(5 << 30)},
+				{"pool": "scratch", "ratio": 1.5, "avail_bytes": int64(512 << 10)},
+				{"pool": "offline"},
+			},
+		},
+		{Name: "Failed", Status: StatusFailed, Output: "FAILED"},
+	}
+	checks := []Check{
+		{Name: "full", Task: "Disks", Each: `use_percent >= 90 && type != "squashfs"`, Severity: IssueWarning, Message: "{{mount}} is {{use_percent}}% full"},
+		{Name: "mismatch", Task: "Sysctl", If: `a != b && up && lines == 2`, Severity: IssueCritical, Message: "a is {{a}}, b is {{ b }}{{missing}}", Hint: "align them"},
+		{Name: "text", Task: "Sysctl", If: `matches("^b = [0-9]$") && !contains("c =")`, Severity: IssueInfo, Message: "b is set"},
+		{Name: "missing", Task: "Sysctl", If: `missing > 0`, Severity: IssueCritical, Message: "never"},
+		{Name: "not run", Task: "Failed", If: `contains("FAILED")`, Severity: IssueCritical, Message: "never"},
+		{Name: "low", Task: "Pools", Each: `avail_bytes < 1000000`, Severity: IssueWarning, Message: "{{pool}} has {{avail_bytes}} bytes left"},
+		{Name: "ratio", Task: "Pools", Each: `ratio >= 1.5 && ratio == "1.50"`, Severity: IssueInfo, Message: "{{pool}} ratio {{ratio}}"},
+		{Name: "unset", Task: "Pools", Each: `avail_bytes == "" && !(ratio < 2) && !(ratio >= 2)`, Severity: IssueInfo, Message: "{{pool}} is not mounted"},
+	}
+	for _, check := range checks {
+		if err := check.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues, err := EvaluateChecks(checks, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Issue{
+		{Check: "mismatch", Task: "Sysctl", Severity: IssueCritical, Message: "a is 1, b is 2", Hint: "align them"},
+		{Check: "full", Task: "Disks", Severity: IssueWarning, Message: "/home is 95% full"},
+		{Check: "low", Task: "Pools", Severity: IssueWarning, Message: "scratch has 524288 bytes left"},
+		{Check: "text", Task: "Sysctl", Severity: IssueInfo, Message: "b is set"},
+		{Check: "ratio", Task: "Pools", Severity: IssueInfo, Message: "scratch ratio 1.5"},
+		{Check: "unset", Task: "Pools", Severity: IssueInfo, Message: "offline is not mounted"},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("got %d issues, want %d: %+v", len(issues), len(want), issues)
+	}
+	for i := range want {
+		if issues[i] != want[i] {
+			t.Errorf("issue %d: got %+v, want %+v", i, issues[i], want[i])
+		}
+	}
+
+	// A condition that cannot be evaluated does not stop the other checks
+	bad := []Check{
+		{Name: "bad", Task: "Sysctl", If: `up == "yes"`, Severity: IssueInfo, Message: "bad"},
+		checks[2],
+	}
+	if issues, err := EvaluateChecks(bad, results); err == nil || len(issues) != 1 {
+		t.Errorf("bool compared with string: %d issues, error %v", len(issues), err)
+	}
+
+	invalid := []Check{
+		{Task: "Disks", If: "true", Severity: IssueInfo, Message: "x"},
+		{Name: "both", Task: "Disks", If: "a", Each: "b", Severity: IssueInfo, Message: "x"},
+		{Name: "severity", Task: "Disks", If: "a", Severity: "fatal", Message: "x"},
+		{Name: "function", Task: "Disks", If: `file_exists("/x")`, Severity: IssueInfo, Message: "x"},
+	}
+	for _, check := range invalid {
+		if err := check.validate(); err == nil {
+			t.Errorf("check %q: no error", check.Name)
+		}
+	}
+}
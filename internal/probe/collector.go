@@ -0,0 +1,91 @@
+package probe
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Record is a set of structured fields describing one fact or item
+type Record map[string]any
+
+// Collection is the output of a collector: text for the report and the
+// same facts as structured fields
+type Collection struct {
+	Text    string   `json:"text"`
+	Fields  Record   `json:"fields,omitempty"`  // facts about the system as a whole
+	Records []Record `json:"records,omitempty"` // one entry per item, such as a mount or a device
+}
+
+// Collector gathers facts natively, reading /proc and /sys through root
+// instead of running a command. Paths in root have no leading slash.
+type Collector interface {
+	Collect(root fs.FS, args []string) (Collection, error)
+}
+
+// CollectorFunc adapts a function to the Collector interface
+type CollectorFunc func(root fs.FS, args []string) (Collection, error)
+
+// Collect calls f
+func (f CollectorFunc) Collect(root fs.FS, args []string) (Collection, error) {
+	return f(root, args)
+}
+
+// collectors holds the registered collectors by name
+var collectors = map[string]Collector{}
+
+// RegisterCollector makes a collector available to `collector:` in manifests
+func RegisterCollector(name string, c Collector) {
+	if _, exists := collectors[name]; exists {
+		panic("probe: collector registered twice: " + name)
+	}
+	collectors[name] = c
+}
+
+// LookupCollector returns the collector with the given name
+func LookupCollector(name string) (Collector, bool) {
+	c, ok := collectors[name]
+	return c, ok
+}
+
+// CollectorNames returns the names of all registered collectors, sorted
+func CollectorNames() []string {
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HostRoot returns the filesystem collectors read on the local system
+func HostRoot() fs.FS {
+	return os.DirFS("/")
+}
+
+// parseCollector splits a `collector:` or `parser:` value such as
+// "lspci-sysfs display" into the name and its arguments
+func parseCollector(spec string) (string, []string) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// checkCollector validates the collector of a task
+func checkCollector(task Task) error {
+	if task.Collector == "" {
+		return nil
+	}
+	if task.Command != "" {
+		return fmt.Errorf("task %q: command and collector are mutually exclusive", task.Name)
+	}
+	name, _ := parseCollector(task.Collector)
+	if _, ok := LookupCollector(name); !ok {
+		return fmt.Errorf("task %q: unknown collector %q (known: %s)", task.Name, name, strings.Join(CollectorNames(), ", "))
+	}
+	return nil
+}
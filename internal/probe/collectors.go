@@ -0,0 +1,684 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func init() {
+	RegisterCollector("cpuinfo", CollectorFunc(collectCPUInfo))
+	RegisterCollector("meminfo", CollectorFunc(collectMemInfo))
+	RegisterCollector("os-release", CollectorFunc(collectOSRelease))
+	RegisterCollector("mounts", CollectorFunc(collectMounts))
+	RegisterCollector("netdev", CollectorFunc(collectNetDev))
+	RegisterCollector("lspci-sysfs", CollectorFunc(collectPCI))
+}
+
+// collectCPUInfo summarizes the processor from /proc/cpuinfo
+func collectCPUInfo(root fs.FS, args []string) (Collection, error) {
+	if err := noArgs("cpuinfo", args); err != nil {
+		return Collection{}, err
+	}
+
+	data, err := fs.ReadFile(root, "proc/cpuinfo")
+	if err != nil {
+		return Collection{}, err
+	}
+
+	// One block of "key : value" lines per logical CPU
+	var blocks []map[string]string
+	for _, block := range strings.Split(string(data), "\n\n") {
+		fields := parseKeyValues(block, ":")
+		if len(fields) > 0 {
+			blocks = append(blocks, fields)
+		}
+	}
+
+	threads := 0
+	sockets := make(map[string]bool)
+	cores := make(map[string]bool)
+	for _, b := range blocks {
+		if _, ok := b["processor"]; !ok {
+			continue
+		}
+		threads++
+		if id, ok := b["physical id"]; ok {
+			sockets[id] = true
+			if core, ok := b["core id"]; ok {
+				cores[id+"/"+core] = true
+			}
+		}
+	}
+	if threads == 0 {
+		return Collection{}, fmt.Errorf("no processors in /proc/cpuinfo")
+	}
+
+	// Model and vendor keys differ between architectures; ARM puts some of
+	// them in a trailing block
+	lookup := func(keys ...string) string {
+		for _, key := range keys {
+			for _, b := range blocks {
+				if v := b[key]; v != "" {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+
+	fields := Record{
+		"model":   lookup("model name", "Model", "Hardware", "cpu"),
+		"vendor":  lookup("vendor_id", "CPU implementer"),
+		"threads": threads,
+		"sockets": max(len(sockets), 1),
+		"cores":   threads,
+	}
+	if len(cores) > 0 {
+		fields["cores"] = len(cores)
+	}
+
+	flags := " " + lookup("flags", "Features") + " "
+	switch {
+	case strings.Contains(flags, " vmx "):
+		fields["virtualization"] = "VT-x"
+	case strings.Contains(flags, " svm "):
+		fields["virtualization"] = "AMD-V"
+	}
+	fields["hypervisor"] = strings.Contains(flags, " hypervisor ")
+
+	if khz, err := readInt(root, "sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq"); err == nil && khz > 0 {
+		fields["max_mhz"] = khz / 1000
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Model: %s\n", orUnknown(fields["model"].(string)))
+	if vendor := fields["vendor"].(string); vendor != "" {
+		fmt.Fprintf(&b, "Vendor: %s\n", vendor)
+	}
+	fmt.Fprintf(&b, "Topology: %s, %s, %s\n",
+		plural(fields["sockets"].(int), "socket"),
+		plural(fields["cores"].(int), "core"),
+		plural(threads, "thread"))
+	if mhz, ok := fields["max_mhz"].(int64); ok {
+		fmt.Fprintf(&b, "Max frequency: %.2f GHz\n", float64(mhz)/1000)
+	}
+	if virt, ok := fields["virtualization"].(string); ok {
+		fmt.Fprintf(&b, "Virtualization: %s\n", virt)
+	}
+	if fields["hypervisor"].(bool) {
+		b.WriteString("Running under a hypervisor\n")
+	}
+
+	return Collection{Text: b.String(), Fields: fields}, nil
+}
+
+// collectMemInfo summarizes memory and swap from /proc/meminfo
+func collectMemInfo(root fs.FS, args []string) (Collection, error) {
+	if err := noArgs("meminfo", args); err != nil {
+		return Collection{}, err
+	}
+
+	data, err := fs.ReadFile(root, "proc/meminfo")
+	if err != nil {
+		return Collection{}, err
+	}
+
+	// Values are in kB
+	kb := make(map[string]uint64)
+	for key, value := range parseKeyValues(string(data), ":") {
+		n, err := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+		if err == nil {
+			kb[key] = n * 1024
+		}
+	}
+
+	total, ok := kb["MemTotal"]
+	if !ok {
+		return Collection{}, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	available, ok := kb["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14
+		available = kb["MemFree"] + kb["Buffers"] + kb["Cached"]
+	}
+	swapUsed := kb["SwapTotal"] - min(kb["SwapFree"], kb["SwapTotal"])
+
+	fields := Record{
+		"total_bytes":      total,
+		"available_bytes":  available,
+		"used_bytes":       total - min(available, total),
+		"free_bytes":       kb["MemFree"],
+		"buffers_bytes":    kb["Buffers"],
+		"cached_bytes":     kb["Cached"],
+		"shared_bytes":     kb["Shmem"],
+		"swap_total_bytes": kb["SwapTotal"],
+		"swap_used_bytes":  swapUsed,
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Memory: %s used of %s (%s available)\n",
+		humanBytes(total-min(available, total)), humanBytes(total), humanBytes(available))
+	if kb["SwapTotal"] > 0 {
+		fmt.Fprintf(&b, "Swap: %s used of %s\n", humanBytes(swapUsed), humanBytes(kb["SwapTotal"]))
+	} else {
+		b.WriteString("Swap: none\n")
+	}
+
+	return Collection{Text: b.String(), Fields: fields}, nil
+}
+
+// collectOSRelease reads os-release(5), unquoting its values
+func collectOSRelease(root fs.FS, args []string) (Collection, error) {
+	if err := noArgs("os-release", args); err != nil {
+		return Collection{}, err
+	}
+
+	data, err := fs.ReadFile(root, "etc/os-release")
+	if err != nil {
+		data, err = fs.ReadFile(root, "usr/lib/os-release")
+		if err != nil {
+			return Collection{}, err
+		}
+	}
+
+	fields := Record{}
+	var b strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = unquoteShell(value)
+		fields[strings.ToLower(key)] = value
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+	}
+
+	return Collection{Text: b.String(), Fields: fields}, scanner.Err()
+}
+
+// collectMounts lists mounted filesystems from /proc/self/mounts. Virtual
+// filesystems are only shown with the "all" argument but always recorded.
+func collectMounts(root fs.FS, args []string) (Collection, error) {
+	showAll := false
+	for _, arg := range args {
+		if arg != "all" {
+			return Collection{}, fmt.Errorf("mounts: unknown argument %q (want all)", arg)
+		}
+		showAll = true
+	}
+
+	data, err := fs.ReadFile(root, "proc/self/mounts")
+	if err != nil {
+		if data, err = fs.ReadFile(root, "proc/mounts"); err != nil {
+			return Collection{}, err
+		}
+	}
+
+	// Filesystems marked nodev in /proc/filesystems have no backing device
+	virtual := make(map[string]bool)
+	if list, err := fs.ReadFile(root, "proc/filesystems"); err == nil {
+		for _, line := range strings.Split(string(list), "\n") {
+			if fstype, ok := strings.CutPrefix(line, "nodev"); ok {
+				virtual[strings.TrimSpace(fstype)] = true
+			}
+		}
+	}
+
+	var records []Record
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSOURCE\tFSTYPE\tOPTIONS")
+
+	shown := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 4 {
+			continue
+		}
+		source, target, fstype, options := unescapeMount(f[0]), unescapeMount(f[1]), f[2], f[3]
+		readOnly := strings.HasPrefix(options+",", "ro,")
+
+		records = append(records, Record{
+			"source":    source,
+			"target":    target,
+			"fstype":    fstype,
+			"options":   options,
+			"read_only": readOnly,
+			"virtual":   virtual[fstype],
+		})
+
+		if virtual[fstype] && !showAll {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", target, source, fstype, options)
+		shown++
+	}
+	w.Flush()
+
+	fields := Record{"mounts": len(records), "shown": shown}
+	return Collection{Text: b.String(), Fields: fields, Records: records}, nil
+}
+
+// collectNetDev lists network interfaces with their state and traffic
+// counters from /proc/net/dev and /sys/class/net
+func collectNetDev(root fs.FS, args []string) (Collection, error) {
+	if err := noArgs("netdev", args); err != nil {
+		return Collection{}, err
+	}
+
+	data, err := fs.ReadFile(root, "proc/net/dev")
+	if err != nil {
+		return Collection{}, err
+	}
+
+	var records []Record
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IFACE\tSTATE\tMTU\tSPEED\tRX\tTX\tERRORS\tDROPPED")
+
+	for _, line := range strings.Split(string(data), "\n") {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		c := strings.Fields(counters)
+		if len(c) < 16 {
+			continue
+		}
+
+		// Receive: bytes packets errs drop fifo frame compressed multicast,
+		// then the same for transmit
+		n := make([]uint64, 16)
+		for i := range n {
+			n[i], _ = strconv.ParseUint(c[i], 10, 64)
+		}
+
+		dir := path.Join("sys/class/net", name)
+		record := Record{
+			"name":       name,
+			"state":      readString(root, path.Join(dir, "operstate")),
+			"mac":        readString(root, path.Join(dir, "address")),
+			"rx_bytes":   n[0],
+			"rx_packets": n[1],
+			"rx_errors":  n[2],
+			"rx_dropped": n[3],
+			"tx_bytes":   n[8],
+			"tx_packets": n[9],
+			"tx_errors":  n[10],
+			"tx_dropped": n[11],
+		}
+		mtu, _ := readInt(root, path.Join(dir, "mtu"))
+		record["mtu"] = mtu
+		speed := "-"
+		// Reading speed fails, or gives -1, when there is no link
+		if mbps, err := readInt(root, path.Join(dir, "speed")); err == nil && mbps > 0 {
+			record["speed_mbps"] = mbps
+			speed = fmt.Sprintf("%dMb/s", mbps)
+		}
+		records = append(records, record)
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%d\t%d\n", name, orUnknown(record["state"].(string)), mtu, speed,
+			humanBytes(n[0]), humanBytes(n[8]), n[2]+n[10], n[3]+n[11])
+	}
+	w.Flush()
+
+	return Collection{Text: b.String(), Fields: Record{"interfaces": len(records)}, Records: records}, nil
+}
+
+// pciClassFilters maps lspci-sysfs arguments to PCI class code prefixes
+var pciClassFilters = map[string]string{
+	"storage":    "01",
+	"network":    "02",
+	"display":    "03",
+	"multimedia": "04",
+	"audio":      "0403",
+	"bridge":     "06",
+	"usb":        "0c03",
+	"wireless":   "0d",
+}
+
+// pciClassNames names common PCI classes by class and subclass
+var pciClassNames = map[string]string{
+	"0000": "Non-VGA unclassified device",
+	"0100": "SCSI storage controller",
+	"0101": "IDE interface",
+	"0104": "RAID bus controller",
+	"0106": "SATA controller",
+	"0107": "Serial Attached SCSI controller",
+	"0108": "Non-Volatile memory controller",
+	"0200": "Ethernet controller",
+	"0280": "Network controller",
+	"0300": "VGA compatible controller",
+	"0302": "3D controller",
+	"0380": "Display controller",
+	"0400": "Multimedia video controller",
+	"0401": "Multimedia audio controller",
+	"0403": "Audio device",
+	"0500": "RAM memory",
+	"0600": "Host bridge",
+	"0601": "ISA bridge",
+	"0604": "PCI bridge",
+	"0700": "Serial controller",
+	"0780": "Communication controller",
+	"0805": "SD Host controller",
+	"0880": "System peripheral",
+	"0c03": "USB controller",
+	"0c05": "SMBus",
+	"0c80": "Serial bus controller",
+	"0d11": "Bluetooth",
+	"0d80": "Wireless controller",
+	"1080": "Encryption controller",
+	"1180": "Signal processing controller",
+	"1200": "Processing accelerators",
+}
+
+// pciBaseClassNames names PCI classes by base class alone
+var pciBaseClassNames = map[string]string{
+	"01": "Mass storage controller",
+	"02": "Network controller",
+	"03": "Display controller",
+	"04": "Multimedia controller",
+	"05": "Memory controller",
+	"06": "Bridge",
+	"07": "Communication controller",
+	"08": "Generic system peripheral",
+	"09": "Input device controller",
+	"0c": "Serial bus controller",
+	"0d": "Wireless controller",
+	"10": "Encryption controller",
+	"11": "Signal processing controller",
+	"12": "Processing accelerators",
+	"ff": "Unassigned class",
+}
+
+// pciIDPaths are the usual locations of the pci.ids database
+var pciIDPaths = []string{
+	"usr/share/hwdata/pci.ids",
+	"usr/share/misc/pci.ids",
+	"usr/share/pci.ids",
+}
+
+// collectPCI lists PCI devices from /sys/bus/pci/devices, like lspci but
+// without needing pciutils. Arguments restrict the listing to classes such
+// as "display" or hex class prefixes such as "0c03".
+func collectPCI(root fs.FS, args []string) (Collection, error) {
+	var prefixes []string
+	for _, arg := range args {
+		prefix, ok := pciClassFilters[arg]
+		if !ok {
+			if _, err := strconv.ParseUint(arg, 16, 32); err != nil || len(arg) > 6 {
+				return Collection{}, fmt.Errorf("lspci-sysfs: unknown class %q", arg)
+			}
+			prefix = strings.ToLower(arg)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	const devicesDir = "sys/bus/pci/devices"
+	entries, err := fs.ReadDir(root, devicesDir)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	var records []Record
+	for _, entry := range entries {
+		dir := path.Join(devicesDir, entry.Name())
+		class := strings.TrimPrefix(readString(root, path.Join(dir, "class")), "0x")
+		if !matchesPrefix(class, prefixes) {
+			continue
+		}
+
+		record := Record{
+			"slot":      entry.Name(),
+			"class":     class,
+			"vendor_id": strings.TrimPrefix(readString(root, path.Join(dir, "vendor")), "0x"),
+			"device_id": strings.TrimPrefix(readString(root, path.Join(dir, "device")), "0x"),
+			"revision":  strings.TrimPrefix(readString(root, path.Join(dir, "revision")), "0x"),
+		}
+		if target, err := fs.ReadLink(root, path.Join(dir, "driver")); err == nil {
+			record["driver"] = path.Base(target)
+		}
+		records = append(records, record)
+	}
+
+	// Vendor and device names are optional
+	names := pciNames(root, records)
+
+	var b strings.Builder
+	for _, record := range records {
+		class := record["class"].(string)
+		className := pciClassName(class)
+		record["class_name"] = className
+
+		id := record["vendor_id"].(string) + ":" + record["device_id"].(string)
+		name := "Device"
+		if vendor, ok := names[record["vendor_id"].(string)]; ok {
+			record["vendor"] = vendor
+			name = vendor
+			if device, ok := names[id]; ok {
+				record["device"] = device
+				name += " " + device
+			}
+		}
+
+		slot := strings.TrimPrefix(record["slot"].(string), "0000:")
+		fmt.Fprintf(&b, "%s %s [%.4s]: %s [%s]", slot, className, class, name, id)
+
+		var extra []string
+		if rev := record["revision"].(string); rev != "" && rev != "00" {
+			extra = append(extra, "rev "+rev)
+		}
+		if driver, ok := record["driver"].(string); ok {
+			extra = append(extra, "driver "+driver)
+		}
+		if len(extra) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(extra, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(records) == 0 {
+		b.WriteString("No matching PCI devices\n")
+	}
+
+	return Collection{Text: b.String(), Fields: Record{"devices": len(records)}, Records: records}, nil
+}
+
+// pciClassName names a 6-digit PCI class code
+func pciClassName(class string) string {
+	if len(class) >= 4 {
+		if name, ok := pciClassNames[class[:4]]; ok {
+			return name
+		}
+	}
+	if len(class) >= 2 {
+		if name, ok := pciBaseClassNames[class[:2]]; ok {
+			return name
+		}
+	}
+	return "Class " + class
+}
+
+// pciNames looks up the vendors and devices of records in pci.ids. The
+// result maps "vvvv" to vendor names and "vvvv:dddd" to device names.
+func pciNames(root fs.FS, records []Record) map[string]string {
+	wanted := make(map[string]bool)
+	for _, record := range records {
+		wanted[record["vendor_id"].(string)] = true
+		wanted[record["vendor_id"].(string)+":"+record["device_id"].(string)] = true
+	}
+
+	names := make(map[string]string)
+	for _, p := range pciIDPaths {
+		data, err := fs.ReadFile(root, p)
+		if err != nil {
+			continue
+		}
+
+		vendor := ""
+		for _, line := range strings.Split(string(data), "\n") {
+			switch {
+			case line == "" || line[0] == '#':
+				continue
+			case strings.HasPrefix(line, "C "):
+				// The device classes section ends the vendor list
+				return names
+			case strings.HasPrefix(line, "\t\t"):
+				continue
+			case line[0] == '\t':
+				id, name, ok := strings.Cut(strings.TrimPrefix(line, "\t"), "  ")
+				if ok && wanted[vendor+":"+id] {
+					names[vendor+":"+id] = name
+				}
+			default:
+				id, name, ok := strings.Cut(line, "  ")
+				if !ok {
+					continue
+				}
+				vendor = id
+				if wanted[id] {
+					names[id] = name
+				}
+			}
+		}
+		return names
+	}
+	return names
+}
+
+// parseKeyValues parses "key<sep>value" lines, trimming both sides. The
+// first occurrence of a key wins.
+func parseKeyValues(text, sep string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if _, exists := values[key]; !exists {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// unquoteShell removes the quoting allowed in os-release values
+func unquoteShell(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		quote := value[0]
+		value = value[1 : len(value)-1]
+		if quote == '\'' {
+			return value
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && strings.IndexByte("\"\\$`", value[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// unescapeMount decodes the octal escapes (\040 for space) used in mounts
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// matchesPrefix reports whether s starts with any prefix, or prefixes is empty
+func matchesPrefix(s string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readString reads a one-line sysfs attribute, returning "" on error
+func readString(root fs.FS, name string) string {
+	data, err := fs.ReadFile(root, name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readInt reads a numeric sysfs attribute
+func readInt(root fs.FS, name string) (int64, error) {
+	data, err := fs.ReadFile(root, name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// noArgs rejects arguments for collectors that take none
+func noArgs(name string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("%s: unexpected arguments %q", name, strings.Join(args, " "))
+	}
+	return nil
+}
+
+// humanBytes formats a byte count with binary units, e.g. "15.5 GiB"
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// plural formats a count with a noun, e.g. "1 socket" or "8 cores"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// orUnknown substitutes "unknown" for an empty value
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package probe
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// collect runs a registered collector over a fixture tree
+func collect(t *testing.T, root fs.FS, spec string) Collection {
+	t.Helper()
+	name, args := parseCollector(spec)
+	collector, ok := LookupCollector(name)
+	if !ok {
+		t.Fatalf("no collector %q", name)
+	}
+	c, err := collector.Collect(root, args)
+	if err != nil {
+		t.Fatalf("%s: %v", spec, err)
+	}
+	return c
+}
+
+// file makes a fixture file
+func file(text string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(text)}
+}
+
+func TestCollectCPUInfo(t *testing.T) {
+	block := func(processor, core string) string {
+		return "processor\t: " + processor + "\nvendor_id\t: GenuineIntel\nmodel name\t: Intel(R) Core(TM) i7-8550U CPU @ 1.80GHz\n" +
+			"physical id\t: 0\ncore id\t\t: " + core + "\nflags\t\t: fpu vme sse2 vmx ht\n"
+	}
+	root := fstest.MapFS{
+		"proc/cpuinfo": file(block("0", "0") + "\n" + block("1", "0") + "\n" + block("2", "1") + "\n" + block("3", "1") + "\n"),
+		"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq": file("4000000\n"),
+	}
+	c := collect(t, root, "cpuinfo")
+	want := Record{"model": "Intel(R) Core(TM) i7-8550U CPU @ 1.80GHz", "vendor": "GenuineIntel", "threads": 4, "cores": 2, "sockets": 1,
+		"virtualization": "VT-x", "hypervisor": false, "max_mhz": int64(4000)}
+	checkRecord(t, c.Fields, want)
+	if !strings.Contains(c.Text, "Topology: 1 socket, 2 cores, 4 threads\n") || !strings.Contains(c.Text, "Max frequency: 4.00 GHz") {
+		t.Errorf("text:\n%s", c.Text)
+	}
+
+	// A guest has the hypervisor flag, no physical ids and no cpufreq
+	guest := fstest.MapFS{
+		"proc/cpuinfo": file("processor\t: 0\nvendor_id\t: AuthenticAMD\nmodel name\t: AMD EPYC 7B13\nflags\t\t: fpu sse2 hypervisor\n\n" +
+			"processor\t: 1\nvendor_id\t: AuthenticAMD\nmodel name\t: AMD EPYC 7B13\nflags\t\t: fpu sse2 hypervisor\n"),
+	}
+	c = collect(t, guest, "cpuinfo")
+	checkRecord(t, c.Fields, Record{"threads": 2, "cores": 2, "sockets": 1, "hypervisor": true})
+	if _, ok := c.Fields["virtualization"]; ok {
+		t.Errorf("guest without vmx or svm has virtualization %v", c.Fields["virtualization"])
+	}
+	if !strings.Contains(c.Text, "Running under a hypervisor") || strings.Contains(c.Text, "Max frequency") {
+		t.Errorf("guest text:\n%s", c.Text)
+	}
+
+	if _, err := collectCPUInfo(fstest.MapFS{"proc/cpuinfo": file("\n")}, nil); err == nil {
+		t.Error("no processors: no error")
+	}
+}
+
+func TestCollectMemInfo(t *testing.T) {
+	root := fstest.MapFS{
+		"proc/meminfo": file("MemTotal:       16000000 kB\nMemFree:         2000000 kB\nMemAvailable:    8000000 kB\n" +
+			"Buffers:          500000 kB\nCached:          4000000 kB\nShmem:            300000 kB\nSwapTotal:       4000000 kB\nSwapFree:        3000000 kB\n"),
+	}
+	c := collect(t, root, "meminfo")
+	checkRecord(t, c.Fields, Record{"total_bytes": uint64(16000000 * 1024), "available_bytes": uint64(8000000 * 1024),
+		"used_bytes": uint64(8000000 * 1024), "swap_used_bytes": uint64(1000000 * 1024), "shared_bytes": uint64(300000 * 1024)})
+	if !strings.Contains(c.Text, "Swap: 976.6 MiB used of 3.8 GiB") {
+		t.Errorf("text:\n%s", c.Text)
+	}
+
+	// Kernels before 3.14 have no MemAvailable, and there may be no swap
+	old := fstest.MapFS{
+		"proc/meminfo": file("MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 50 kB\nCached: 250 kB\nSwapTotal: 0 kB\nSwapFree: 0 kB\n"),
+	}
+	c = collect(t, old, "meminfo")
+	checkRecord(t, c.Fields, Record{"available_bytes": uint64(400 * 1024), "used_bytes": uint64(600 * 1024), "swap_used_bytes": uint64(0)})
+	if !strings.Contains(c.Text, "Swap: none") {
+		t.Errorf("text without swap:\n%s", c.Text)
+	}
+
+	if _, err := collectMemInfo(fstest.MapFS{"proc/meminfo": file("MemFree: 1 kB\n")}, nil); err == nil {
+		t.Error("no MemTotal: no error")
+	}
+}
+
+func TestCollectOSRelease(t *testing.T) {
+	// /etc/os-release is missing, so the copy in /usr/lib is read
+	root := fstest.MapFS{
+		"usr/lib/os-release": file("# comment\nNAME=\"Arch Linux\"\nID=arch\nPRETTY_NAME='Arch \"Linux\"'\nBUILD_ID=\"roll\\$ing\"\n\nbroken line\n"),
+	}
+	c := collect(t, root, "os-release")
+	checkRecord(t, c.Fields, Record{"name": "Arch Linux", "id": "arch", "pretty_name": `Arch "Linux"`, "build_id": "roll$ing"})
+	if len(c.Fields) != 4 || !strings.HasPrefix(c.Text, "NAME=Arch Linux\n") {
+		t.Errorf("fields %v, text:\n%s", c.Fields, c.Text)
+	}
+}
+
+func TestCollectMounts(t *testing.T) {
+	root := fstest.MapFS{
+		"proc/self/mounts": file("/dev/nvme0n1p2 / ext4 rw,relatime 0 0\n" +
+			"proc /proc proc rw,nosuid 0 0\n" +
+			"/dev/sdb1 /media/My\\040Disk vfat ro,noatime 0 0\n" +
+			"short line\n"),
+		"proc/filesystems": file("nodev\tsysfs\nnodev\tproc\n\text4\n\tvfat\n"),
+	}
+	c := collect(t, root, "mounts")
+	if len(c.Records) != 3 {
+		t.Fatalf("records: %v", c.Records)
+	}
+	checkRecord(t, c.Records[1], Record{"target": "/proc", "virtual": true, "read_only": false})
+	checkRecord(t, c.Records[2], Record{"source": "/dev/sdb1", "target": "/media/My Disk", "fstype": "vfat", "read_only": true, "virtual": false})
+	checkRecord(t, c.Fields, Record{"mounts": 3, "shown": 2})
+	if strings.Contains(c.Text, "/proc") || !strings.Contains(c.Text, "/media/My Disk") {
+		t.Errorf("text:\n%s", c.Text)
+	}
+
+	c = collect(t, root, "mounts all")
+	checkRecord(t, c.Fields, Record{"shown": 3})
+
+	if _, err := collectMounts(root, []string{"some"}); err == nil {
+		t.Error("unknown argument: no error")
+	}
+}
+
+func TestCollectNetDev(t *testing.T) {
+	root := fstest.MapFS{
+		"proc/net/dev": file("Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo:  1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0\n" +
+			"  eth0: 2097152  2000    1    2    0     0          0         0  1048576    1000    3    4    0     0       0          0\n"),
+		"sys/class/net/eth0/operstate": file("up\n"),
+		"sys/class/net/eth0/address":   file("52:54:00:12:34:56\n"),
+		"sys/class/net/eth0/mtu":       file("1500\n"),
+		"sys/class/net/eth0/speed":     file("1000\n"),
+		"sys/class/net/lo/operstate":   file("unknown\n"),
+		"sys/class/net/lo/mtu":         file("65536\n"),
+		"sys/class/net/lo/speed":       file("-1\n"),
+	}
+	c := collect(t, root, "netdev")
+	if len(c.Records) != 2 {
+		t.Fatalf("records: %v", c.Records)
+	}
+	if _, ok := c.Records[0]["speed_mbps"]; ok {
+		t.Errorf("lo has a speed: %v", c.Records[0])
+	}
+	checkRecord(t, c.Records[1], Record{"name": "eth0", "state": "up", "mac": "52:54:00:12:34:56", "mtu": int64(1500), "speed_mbps": int64(1000),
+		"rx_bytes": uint64(2097152), "rx_errors": uint64(1), "rx_dropped": uint64(2), "tx_bytes": uint64(1048576), "tx_errors": uint64(3), "tx_dropped": uint64(4)})
+	if !strings.Contains(c.Text, "eth0   up       1500   1000Mb/s  2.0 MiB  1.0 MiB  4       6") {
+		t.Errorf("text:\n%s", c.Text)
+	}
+}
+
+func TestCollectPCI(t *testing.T) {
+	dev := "sys/bus/pci/devices/"
+	root := fstest.MapFS{
+		dev + "0000:00:02.0/class":    file("0x030000\n"),
+		dev + "0000:00:02.0/vendor":   file("0x8086\n"),
+		dev + "0000:00:02.0/device":   file("0x5917\n"),
+		dev + "0000:00:02.0/revision": file("0x07\n"),
+		dev + "0000:00:02.0/driver":   &fstest.MapFile{Data: []byte("../../../bus/pci/drivers/i915"), Mode: fs.ModeSymlink},
+		// No driver is bound to the card reader
+		dev + "0000:3b:00.0/class":    file("0xff0000\n"),
+		dev + "0000:3b:00.0/vendor":   file("0x10ec\n"),
+		dev + "0000:3b:00.0/device":   file("0x525a\n"),
+		dev + "0000:3b:00.0/revision": file("0x00\n"),
+		"usr/share/hwdata/pci.ids": file("# pci.ids\n8086  Intel Corporation\n\t5917  UHD Graphics 620\n\t\t1028 0810  Subsystem\n" +
+			"10ec  Realtek Semiconductor Co., Ltd.\nC 00  Unclassified device\n"),
+	}
+	c := collect(t, root, "lspci-sysfs")
+	if len(c.Records) != 2 {
+		t.Fatalf("records: %v", c.Records)
+	}
+	checkRecord(t, c.Records[0], Record{"slot": "0000:00:02.0", "class_name": "VGA compatible controller", "vendor": "Intel Corporation",
+		"device": "UHD Graphics 620", "driver": "i915", "revision": "07"})
+	if _, ok := c.Records[1]["driver"]; ok {
+		t.Errorf("device without a driver link has one: %v", c.Records[1])
+	}
+	want := "00:02.0 VGA compatible controller [0300]: Intel Corporation UHD Graphics 620 [8086:5917] (rev 07, driver i915)\n" +
+		"3b:00.0 Unassigned class [ff00]: Realtek Semiconductor Co., Ltd. [10ec:525a]\n"
+	if c.Text != want {
+		t.Errorf("text:\n%s\nwant:\n%s", c.Text, want)
+	}
+
+	c = collect(t, root, "lspci-sysfs display")
+	if len(c.Records) != 1 {
+		t.Errorf("display devices: %v", c.Records)
+	}
+	c = collect(t, root, "lspci-sysfs 0c03")
+	if c.Text != "No matching PCI devices\n" {
+		t.Errorf("no USB controllers:\n%s", c.Text)
+	}
+	if _, err := collectPCI(root, []string{"toasters"}); err == nil {
+		t.Error("unknown class: no error")
+	}
+}
+
+// checkRecord compares the given keys of a record
+func checkRecord(t *testing.T, got, want Record) {
+	t.Helper()
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %#v, want %#v", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/expr"
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// unitCheckTimeout bounds the systemctl call made by unit_active
+const unitCheckTimeout = 5 * time.Second
+
+// conditionVars are the variables available to `when:` expressions. The
+// short names are aliases of the platform.* ones.
+var conditionVars = []string{
+	"platform.os", "platform.arch", "platform.distro", "platform.version",
+	"platform.kernel", "platform.wm", "platform.root", "platform.wayland",
+	"os", "arch", "distro", "version", "kernel", "wm", "root", "wayland",
+}
+
+// conditionFuncs are the functions available to `when:` expressions, with
+// their number of arguments
+var conditionFuncs = map[string]int{
+	"file_exists":      1, // a file or directory exists
+	"dir_exists":       1, // a directory exists
+	"glob_exists":      1, // any path matches a glob, e.g. /sys/class/power_supply/BAT*
+	"command_exists":   1, // a binary is on PATH
+	"module_loaded":    1, // a kernel module is loaded
+	"fs_mounted":       1, // a filesystem of this type is mounted
+	"unit_active":      1, // a systemd system unit is active
+	"user_unit_active": 1, // a systemd user unit is active
+	"like":             1, // the distro is or derives from this ID
+	"tag":              1, // the environment matches a task tag such as wayland
+}
+
+// parseCondition parses and checks a `when:` expression
+func parseCondition(when string) (*expr.Expr, error) {
+	e, err := expr.Parse(when)
+	if err != nil {
+		return nil, fmt.Errorf("when: %w", err)
+	}
+	if err := e.Check(conditionVars, conditionFuncs); err != nil {
+		return nil, fmt.Errorf("when: %w", err)
+	}
+	return e, nil
+}
+
+// conditionEnv evaluates `when:` expressions against the platform and the
+// filesystem the collectors read
+type conditionEnv struct {
+	platform platform.Platform
+	root     fs.FS
+}
+
+// Var returns the value of a condition variable
+func (c conditionEnv) Var(name string) (expr.Value, bool) {
+	p := c.platform
+	switch strings.TrimPrefix(name, "platform.") {
+	case "os":
+		return p.OS, true
+	case "arch":
+		return p.Arch, true
+	case "distro":
+		return p.Distro, true
+	case "version":
+		return p.VersionID, true
+	case "kernel":
+		return p.Kernel, true
+	case "wm":
+		return p.WM, true
+	case "root":
+		return p.IsRoot, true
+	case "wayland":
+		return p.IsWayland, true
+	}
+	return nil, false
+}
+
+// Call evaluates a condition function
+func (c conditionEnv) Call(name string, args []string) (bool, error) {
+	arg := args[0]
+	switch name {
+	case "file_exists":
+		_, err := fs.Stat(c.root, rootPath(arg))
+		return err == nil, nil
+	case "dir_exists":
+		info, err := fs.Stat(c.root, rootPath(arg))
+		return err == nil && info.IsDir(), nil
+	case "glob_exists":
+		matches, err := fs.Glob(c.root, rootPath(arg))
+		return len(matches) > 0, err
+	case "command_exists":
+		_, err := exec.LookPath(arg)
+		return err == nil, nil
+	case "module_loaded":
+		return c.moduleLoaded(arg), nil
+	case "fs_mounted":
+		return c.fsMounted(arg), nil
+	case "unit_active":
+		return unitActive(arg, false), nil
+	case "user_unit_active":
+		return unitActive(arg, true), nil
+	case "like":
+		return c.platform.IsLike(arg), nil
+	case "tag":
+		return c.platform.MatchesTags([]string{arg}), nil
+	}
+	return false, fmt.Errorf("unknown function")
+}
+
+// moduleLoaded reports whether /proc/modules lists a module. Dashes and
+// underscores are interchangeable in module names.
+func (c conditionEnv) moduleLoaded(name string) bool {
+	name = strings.ReplaceAll(name, "-", "_")
+	return c.scanLines("proc/modules", func(fields []string) bool {
+		return fields[0] == name
+	})
+}
+
+// fsMounted reports whether a filesystem of the given type is mounted
+func (c conditionEnv) fsMounted(fstype string) bool {
+	return c.scanLines("proc/self/mounts", func(fields []string) bool {
+		return len(fields) > 2 && fields[2] == fstype
+	})
+}
+
+// scanLines reports whether match accepts the fields of any line of a file
+func (c conditionEnv) scanLines(path string, match func(fields []string) bool) bool {
+	f, err := c.root.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 && match(fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// unitActive asks systemctl whether a unit is active
+func unitActive(unit string, user bool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), unitCheckTimeout)
+	defer cancel()
+
+	args := []string{"is-active", "--quiet", unit}
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.CommandContext(ctx, "systemctl", args...).Run() == nil
+}
+
+// rootPath turns an absolute path into one relative to a collector root
+func rootPath(path string) string {
+	path = strings.TrimLeft(path, "/")
+	if path == "" {
+		return "."
+	}
+	return path
+}
@@ -0,0 +1,219 @@
+package probe
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Facts holds the values exported by finished tasks, by task ID and then
+// by export name
+type Facts map[string]map[string][]string
+
+// idPattern is the format of task IDs and export names
+var idPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// placeholderPattern matches {{id.name}} in commands
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z][a-z0-9_-]*)\.([a-z][a-z0-9_-]*)\s*\}\}`)
+
+// checkExports validates the ID, dependencies and exports of a task on its
+// own; references between tasks are checked by checkDependencies
+func checkExports(t Task) error {
+	if t.ID != "" && !idPattern.MatchString(t.ID) {
+		return fmt.Errorf("task %q: invalid id %q (lowercase letters, digits, - and _)", t.Name, t.ID)
+	}
+	if len(t.Exports) > 0 && t.ID == "" {
+		return fmt.Errorf("task %q: exports require an id", t.Name)
+	}
+	for name, pattern := range t.Exports {
+		if !idPattern.MatchString(name) {
+			return fmt.Errorf("task %q: invalid export name %q", t.Name, name)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("task %q: export %q: %w", t.Name, name, err)
+		}
+		if re.NumSubexp() > 1 {
+			return fmt.Errorf("task %q: export %q: use at most one capture group", t.Name, name)
+		}
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(t.Command, -1) {
+		if !containsString(t.DependsOn, m[1]) {
+			return fmt.Errorf("task %q: %s needs depends_on: %s", t.Name, m[0], m[1])
+		}
+	}
+	return nil
+}
+
+// checkDependencies verifies that IDs are unique, that every dependency and
+// placeholder refers to an exported value of a loaded task, and that there
+// are no cycles
+func checkDependencies(tasks []Task) error {
+	byID := make(map[string]Task)
+	for _, t := range tasks {
+		if t.ID == "" {
+			continue
+		}
+		if other, exists := byID[t.ID]; exists {
+			return fmt.Errorf("tasks %q and %q share the id %q", other.Name, t.Name, t.ID)
+		}
+		byID[t.ID] = t
+	}
+
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return fmt.Errorf("task %q depends on unknown task %q", t.Name, dep)
+			}
+		}
+		for _, m := range placeholderPattern.FindAllStringSubmatch(t.Command, -1) {
+			if _, ok := byID[m[1]].Exports[m[2]]; !ok {
+				return fmt.Errorf("task %q: %s is not exported by %q", t.Name, m[0], byID[m[1]].Name)
+			}
+		}
+	}
+
+	// Depth-first search for cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(id string, path []string) error
+	visit = func(id string, path []string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, id), " -> "))
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, dep := range byID[id].DependsOn {
+			if err := visit(dep, append(path, id)); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := visit(id, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithDependencies returns the selected tasks together with the tasks they
+// depend on, directly or not, in the order of all
+func WithDependencies(all, selected []Task) []Task {
+	byID := make(map[string]Task)
+	for _, t := range all {
+		if t.ID != "" {
+			byID[t.ID] = t
+		}
+	}
+
+	needed := make(map[string]bool)
+	var require func(deps []string)
+	require = func(deps []string) {
+		for _, dep := range deps {
+			if needed[dep] {
+				continue
+			}
+			needed[dep] = true
+			require(byID[dep].DependsOn)
+		}
+	}
+	chosen := make(map[string]bool)
+	for _, t := range selected {
+		chosen[t.Name] = true
+		require(t.DependsOn)
+	}
+
+	var tasks []Task
+	for _, t := range all {
+		if chosen[t.Name] || (t.ID != "" && needed[t.ID]) {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// exportValues extracts the task's exports from its output. Each export is
+// a regular expression matched against every line; the values are its
+// first capture group, or the whole match if it has none.
+func (t Task) exportValues(output string) map[string][]string {
+	if len(t.Exports) == 0 {
+		return nil
+	}
+	values := make(map[string][]string, len(t.Exports))
+	for name, pattern := range t.Exports {
+		re := regexp.MustCompile("(?m)" + pattern)
+		var found []string
+		for _, m := range re.FindAllStringSubmatch(output, -1) {
+			found = append(found, m[len(m)-1])
+		}
+		values[name] = found
+	}
+	return values
+}
+
+// withFacts returns the task with {{id.name}} placeholders in its command
+// replaced by the exported values, each as a single-quoted shell word, and
+// the values of its dependencies in the environment as SYSPROBE_<ID>_<NAME>
+// (newline separated)
+func (t Task) withFacts(facts Facts) Task {
+	if len(t.DependsOn) == 0 {
+		return t
+	}
+
+	t.Command = placeholderPattern.ReplaceAllStringFunc(t.Command, func(placeholder string) string {
+		m := placeholderPattern.FindStringSubmatch(placeholder)
+		words := make([]string, 0, len(facts[m[1]][m[2]]))
+		for _, value := range facts[m[1]][m[2]] {
+			words = append(words, shellQuote(value))
+		}
+		return strings.Join(words, " ")
+	})
+
+	t.env = nil
+	for _, dep := range t.DependsOn {
+		names := make([]string, 0, len(facts[dep]))
+		for name := range facts[dep] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t.env = append(t.env, factEnvName(dep, name)+"="+strings.Join(facts[dep][name], "\n"))
+		}
+	}
+	return t
+}
+
+// factEnvName returns the environment variable holding an exported value
+func factEnvName(id, name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_").Replace("SYSPROBE_" + id + "_" + name))
+}
+
+// shellQuote quotes s as a single sh word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
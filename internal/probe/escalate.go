@@ -0,0 +1,395 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Escalation methods accepted by StartEscalation
+const (
+	EscalateSudo   = "sudo"
+	EscalatePkexec = "pkexec"
+	EscalateDoas   = "doas"
+)
+
+// maxEscalationMessage bounds one line of the helper protocol. Results hold
+// at most max_bytes of output per stream, so this is generous.
+const maxEscalationMessage = 64 * 1024 * 1024
+
+// escalatedTask is the part of a Task the helper needs to run it. Timeout
+// is always set, since the helper does not know the parent's default.
+type escalatedTask struct {
+	Name         string        `json:"name"`
+	Command      string        `json:"command,omitempty"`
+	Collector    string        `json:"collector,omitempty"`
+	Parser       string        `json:"parser,omitempty"`
+	Category     string        `json:"category,omitempty"`
+	Priority     int           `json:"priority,omitempty"`
+	MaxLines     int           `json:"max_lines,omitempty"`
+	MaxBytes     int           `json:"max_bytes,omitempty"`
+	Timeout      time.Duration `json:"timeout"`
+	Retries      int           `json:"retries,omitempty"`
+	RetryBackoff time.Duration `json:"retry_backoff,omitempty"`
+	OkExitCodes  []int         `json:"ok_exit_codes,omitempty"`
+	EmptyIs      string        `json:"empty_is,omitempty"`
+	Nice         int           `json:"nice,omitempty"`
+	IONice       string        `json:"ionice,omitempty"`
+	MaxMemory    int64         `json:"max_memory,omitempty"`
+	Env          []string      `json:"env,omitempty"`
+}
+
+func newEscalatedTask(task Task) escalatedTask {
+	return escalatedTask{
+		Name:         task.Name,
+		Command:      task.Command,
+		Collector:    task.Collector,
+		Parser:       task.Parser,
+		Category:     task.Category,
+		Priority:     task.Priority,
+		MaxLines:     task.MaxLines,
+		MaxBytes:     task.MaxBytes,
+		Timeout:      task.Timeout,
+		Retries:      task.Retries,
+		RetryBackoff: task.RetryBackoff,
+		OkExitCodes:  task.OkExitCodes,
+		EmptyIs:      task.EmptyIs,
+		Nice:         task.Nice,
+		IONice:       task.IONice,
+		MaxMemory:    int64(task.MaxMemory),
+		Env:          task.env,
+	}
+}
+
+func (t escalatedTask) task() Task {
+	return Task{
+		Name:         t.Name,
+		Command:      t.Command,
+		Collector:    t.Collector,
+		Parser:       t.Parser,
+		Category:     t.Category,
+		Priority:     t.Priority,
+		MaxLines:     t.MaxLines,
+		MaxBytes:     t.MaxBytes,
+		Timeout:      t.Timeout,
+		Retries:      t.Retries,
+		RetryBackoff: t.RetryBackoff,
+		OkExitCodes:  t.OkExitCodes,
+		EmptyIs:      t.EmptyIs,
+		Nice:         t.Nice,
+		IONice:       t.IONice,
+		MaxMemory:    ByteSize(t.MaxMemory),
+		env:          t.Env,
+	}
+}
+
+// escalationRequest asks the helper to run a task
+type escalationRequest struct {
+	ID   int           `json:"id"`
+	Task escalatedTask `json:"task"`
+}
+
+// escalationEvent is a line written by the helper: first a ready event once
+// it runs as root, then for each task a started event right before its
+// command runs and a result once it finishes
+type escalationEvent struct {
+	Ready   bool        `json:"ready,omitempty"`
+	ID      int         `json:"id,omitempty"`
+	Started string      `json:"started,omitempty"` // the command about to run as root
+	Result  *TaskResult `json:"result,omitempty"`
+}
+
+// AuditEntry records a command run as root on behalf of the user
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Event    string    `json:"event"` // "start" or "finish"
+	Task     string    `json:"task"`
+	Command  string    `json:"command"`
+	Status   *Status   `json:"status,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+}
+
+// Escalator runs privileged tasks in a single helper process started
+// through sudo, pkexec or doas, so the user authenticates once per run
+type Escalator struct {
+	Method string
+
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	audit      *json.Encoder // nil if no audit log is kept
+	auditClose func() error  // closes the audit log, if it is a file
+
+	mu      sync.Mutex
+	enc     *json.Encoder
+	nextID  int
+	pending map[int]pendingTask
+
+	closeOnce sync.Once
+	exited    chan struct{} // closed once the helper has exited
+	err       error         // why the helper exited, valid after exited is closed
+	waitErr   error         // the helper's exit status
+}
+
+// pendingTask is a task sent to the helper that has not finished yet
+type pendingTask struct {
+	task   Task
+	result chan TaskResult
+}
+
+// StartEscalation starts the helper command through the given method and
+// waits until it runs as root, which is when the password prompt, if any,
+// has been answered. Each command the helper runs is recorded in audit as
+// one JSON line when it starts and when it finishes. If audit is also an
+// io.Closer, it is closed with the escalator, or right away if the helper
+// does not start.
+func StartEscalation(method string, helper []string, audit io.Writer) (e *Escalator, err error) {
+	if closer, ok := audit.(io.Closer); ok {
+		defer func() {
+			if err != nil {
+				closer.Close()
+			}
+		}()
+	}
+
+	var args []string
+	switch method {
+	case EscalateSudo:
+		args = append([]string{"--prompt=[sysprobe] password for %p: ", "--"}, helper...)
+	case EscalatePkexec, EscalateDoas:
+		args = helper
+	default:
+		return nil, fmt.Errorf("unknown escalation method %q (want sudo, pkexec or doas)", method)
+	}
+	if _, err := exec.LookPath(method); err != nil {
+		return nil, fmt.Errorf("escalation: %w", err)
+	}
+
+	cmd := exec.Command(method, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("escalation: %w", err)
+	}
+
+	e = &Escalator{
+		Method:  method,
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		pending: make(map[int]pendingTask),
+		exited:  make(chan struct{}),
+	}
+	if audit != nil {
+		e.audit = json.NewEncoder(audit)
+		if closer, ok := audit.(io.Closer); ok {
+			e.auditClose = closer.Close
+		}
+	}
+
+	// The helper announces itself once authentication succeeded
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxEscalationMessage)
+	var ready escalationEvent
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &ready) != nil || !ready.Ready {
+		stdin.Close()
+		err := cmd.Wait()
+		if err == nil {
+			err = errors.New("helper did not start")
+		}
+		return nil, fmt.Errorf("escalation via %s failed: %w", method, err)
+	}
+
+	go e.read(scanner)
+	return e, nil
+}
+
+// read receives events from the helper until it exits, then fails the
+// tasks it did not finish
+func (e *Escalator) read(scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		var event escalationEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+
+		e.mu.Lock()
+		p, ok := e.pending[event.ID]
+		if ok && event.Result != nil {
+			delete(e.pending, event.ID)
+		}
+		e.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		switch {
+		case event.Result != nil:
+			e.record(AuditEntry{Event: "finish", Task: p.task.Name, Command: event.Result.Command, Status: &event.Result.Status, ExitCode: &event.Result.ExitCode})
+			p.result <- *event.Result
+		case event.Started != "":
+			e.record(AuditEntry{Event: "start", Task: p.task.Name, Command: event.Started})
+		}
+	}
+
+	e.waitErr = e.cmd.Wait()
+	e.err = e.waitErr
+	if e.err == nil {
+		e.err = scanner.Err()
+	}
+	if e.err == nil {
+		e.err = errors.New("helper exited")
+	}
+
+	// Run checks exited under the lock, so no task is added after this
+	e.mu.Lock()
+	for id, p := range e.pending {
+		delete(e.pending, id)
+		p.result <- e.failed(p.task)
+	}
+	close(e.exited)
+	e.mu.Unlock()
+}
+
+// failed returns the result of a task the helper did not finish
+func (e *Escalator) failed(task Task) TaskResult {
+	result := newResult(task)
+	result.Status = StatusFailed
+	result.Error = "Escalation helper exited: " + e.err.Error()
+	result.Escalated = e.Method
+	return result
+}
+
+// record appends an entry to the audit log
+func (e *Escalator) record(entry AuditEntry) {
+	if e.audit == nil {
+		return
+	}
+	entry.Time = time.Now()
+	entry.Method = e.Method
+	_ = e.audit.Encode(entry)
+}
+
+// Run runs a task as root in the helper. If ctx is done first, the helper
+// stops all of its tasks, as the pool does for unprivileged ones.
+func (e *Escalator) Run(ctx context.Context, task Task) TaskResult {
+	done := make(chan TaskResult, 1)
+
+	e.mu.Lock()
+	id := e.nextID + 1
+	e.nextID = id
+	select {
+	case <-e.exited:
+		e.mu.Unlock()
+		return e.failed(task)
+	default:
+	}
+	e.pending[id] = pendingTask{task: task, result: done}
+	err := e.enc.Encode(escalationRequest{ID: id, Task: newEscalatedTask(task)})
+	e.mu.Unlock()
+	if err != nil {
+		// The helper is gone; read fails the pending task once it notices
+		return <-done
+	}
+
+	var result TaskResult
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		e.stop()
+		result = <-done
+	}
+
+	result.Escalated = e.Method
+	if result.Status == StatusCancelled && ctx.Err() != nil {
+		result.Error = "Stopped: " + cancelCause(ctx)
+	}
+	return result
+}
+
+// stop closes the helper's input, which makes it cancel its running tasks
+// and exit
+func (e *Escalator) stop() {
+	e.closeOnce.Do(func() {
+		e.stdin.Close()
+	})
+}
+
+// Close stops the helper, waits for it to exit and closes the audit log
+func (e *Escalator) Close() error {
+	e.stop()
+	<-e.exited
+	if e.auditClose != nil {
+		if err := e.auditClose(); err != nil && e.waitErr == nil {
+			return err
+		}
+	}
+	return e.waitErr
+}
+
+// ServeEscalation is the helper side of an Escalator: it runs the tasks
+// requested on in, already checked by the parent, and writes their results
+// to out. Each command is passed to audit before it runs, and does not run
+// if audit fails, so the root side keeps its own record of what ran. It
+// returns once in is closed, cancelling the tasks still running.
+func (r *Runner) ServeEscalation(ctx context.Context, in io.Reader, out io.Writer, audit func(task Task, command string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(out)
+	send := func(event escalationEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = enc.Encode(event)
+	}
+	send(escalationEvent{Ready: true})
+
+	var wg sync.WaitGroup
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, maxEscalationMessage)
+	for scanner.Scan() {
+		var req escalationRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			cancel()
+			wg.Wait()
+			return fmt.Errorf("invalid request: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := req.Task.task()
+			result := newResult(task)
+			if ctx.Err() != nil {
+				result.Status = StatusCancelled
+				result.Error = "Not started: " + cancelCause(ctx)
+			} else if err := audit(task, result.Command); err != nil {
+				result.Status = StatusFailed
+				result.Error = "Not started: audit log: " + err.Error()
+			} else {
+				send(escalationEvent{ID: req.ID, Started: result.Command})
+				result = r.execute(ctx, task, result)
+			}
+			send(escalationEvent{ID: req.ID, Result: &result})
+		}()
+	}
+
+	cancel()
+	wg.Wait()
+	return scanner.Err()
+}
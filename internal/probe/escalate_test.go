@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// TestServeEscalationAudit checks that the helper records each command
+// before running it and runs nothing it could not record
+func TestServeEscalationAudit(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	serve := func(audit func(Task, string) error) TaskResult {
+		t.Helper()
+		inR, inW := io.Pipe()
+		outR, outW := io.Pipe()
+		runner := NewRunner(platform.Platform{OS: "linux"})
+		go func() {
+			runner.ServeEscalation(context.Background(), inR, outW, audit)
+			outW.Close()
+		}()
+		// Input stays open until the result is in, as the parent's does
+		defer inW.Close()
+		go json.NewEncoder(inW).Encode(escalationRequest{ID: 1, Task: newEscalatedTask(Task{Name: "Touch", Command: "touch " + marker, Timeout: DefaultTimeout})})
+
+		scanner := bufio.NewScanner(outR)
+		for scanner.Scan() {
+			var event escalationEvent
+			json.Unmarshal(scanner.Bytes(), &event)
+			if event.Result != nil {
+				go io.Copy(io.Discard, outR)
+				return *event.Result
+			}
+		}
+		t.Fatal("no result")
+		return TaskResult{}
+	}
+
+	var logged []string
+	result := serve(func(task Task, command string) error {
+		if _, err := os.Stat(marker); err == nil {
+			t.Error("command ran before it was logged")
+		}
+		logged = append(logged, task.Name+": "+command)
+		return nil
+	})
+	if result.Status != StatusSuccess || len(logged) != 1 || logged[0] != "Touch: touch "+marker {
+		t.Errorf("result %+v, logged %q", result, logged)
+	}
+
+	os.Remove(marker)
+	result = serve(func(Task, string) error { return errors.New("no syslog") })
+	if _, err := os.Stat(marker); err == nil || result.Status != StatusFailed {
+		t.Errorf("ran without an audit record: %+v", result)
+	}
+}
@@ -0,0 +1,320 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// FixtureVersion is the version of the fixture format written by Recorder
+const FixtureVersion = 1
+
+// Fixture is a recorded run: the platform and what every task's commands
+// printed. Replaying it runs the same tasks without executing anything, so
+// a report can be regenerated on any machine.
+type Fixture struct {
+	Version  int               `json:"version"`
+	Recorded time.Time         `json:"recorded"`
+	Platform platform.Platform `json:"platform"`
+	Tasks    []TaskRecord      `json:"tasks"`
+
+	byName map[string]*TaskRecord
+}
+
+// TaskRecord is what one task did in a recorded run. Tasks are matched by
+// name on replay; the command is kept for reference.
+type TaskRecord struct {
+	Name       string          `json:"name"`
+	Command    string          `json:"command,omitempty"`
+	SkipReason string          `json:"skip_reason,omitempty"` // why the runner did not start the task
+	Cancelled  bool            `json:"cancelled,omitempty"`   // the run ended before the task did
+	Escalated  string          `json:"escalated,omitempty"`   // method the task ran as root through
+	Attempts   []CommandRecord `json:"attempts,omitempty"`
+	Collection *Collection     `json:"collection,omitempty"` // output of a collector task
+	Error      string          `json:"error,omitempty"`      // why a collector task failed
+}
+
+// CommandRecord is the outcome of one attempt at running a command. Output
+// is kept as the command printed it, before max_lines and max_bytes.
+type CommandRecord struct {
+	Stdout      string  `json:"stdout"`
+	Stderr      string  `json:"stderr"`
+	StdoutBytes int     `json:"stdout_bytes"`
+	StderrBytes int     `json:"stderr_bytes"`
+	ExitCode    int     `json:"exit_code"`
+	Signal      string  `json:"signal,omitempty"`
+	TimedOut    bool    `json:"timed_out,omitempty"`
+	Error       string  `json:"error,omitempty"` // why the command could not be run
+	DurationMS  float64 `json:"duration_ms"`
+}
+
+// duration returns the recorded run time of the attempt
+func (c CommandRecord) duration() time.Duration {
+	return time.Duration(c.DurationMS * float64(time.Millisecond))
+}
+
+// LoadFixture reads a fixture written by Fixture.Save
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseFixture(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// ParseFixture decodes a fixture from JSON
+func ParseFixture(data []byte) (*Fixture, error) {
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != FixtureVersion {
+		return nil, fmt.Errorf("unsupported fixture version %d (want %d)", f.Version, FixtureVersion)
+	}
+	f.index()
+	return &f, nil
+}
+
+// Save writes the fixture as indented JSON, readable enough to review
+// before it is shared
+func (f *Fixture) Save(path string) error {
+	data, err := f.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Marshal encodes the fixture as it is saved
+func (f *Fixture) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// index builds the lookup of task records by name
+func (f *Fixture) index() {
+	f.byName = make(map[string]*TaskRecord, len(f.Tasks))
+	for i := range f.Tasks {
+		f.byName[f.Tasks[i].Name] = &f.Tasks[i]
+	}
+}
+
+// Lookup returns the record of the named task
+func (f *Fixture) Lookup(name string) (*TaskRecord, bool) {
+	if f.byName == nil {
+		f.index()
+	}
+	rec, ok := f.byName[name]
+	return rec, ok
+}
+
+// Filter returns the tasks the fixture has a record of, such as the tasks
+// selected for the recorded run out of all those loaded
+func (f *Fixture) Filter(tasks []Task) []Task {
+	var recorded []Task
+	for _, task := range tasks {
+		if _, ok := f.Lookup(task.Name); ok {
+			recorded = append(recorded, task)
+		}
+	}
+	return recorded
+}
+
+// attempt returns the recorded outcome of attempt n, counting from 0. A task
+// retried more often than it was recorded repeats its last attempt.
+func (rec *TaskRecord) attempt(n int) (CommandRecord, bool) {
+	if len(rec.Attempts) == 0 {
+		return CommandRecord{}, false
+	}
+	return rec.Attempts[min(n, len(rec.Attempts)-1)], true
+}
+
+// Recorder collects what tasks do during a run, to be saved as a fixture.
+// It is safe for concurrent use by the pool's workers. The zero value
+// records a run with no platform or start time; NewRecorder sets both.
+type Recorder struct {
+	// Redact, if set, is applied to recorded output when the fixture is
+	// made, task by task in name order, so that the fixture can be shared
+	// like a report and its placeholders do not depend on timing
+	Redact func(taskName, text string) string
+
+	platform platform.Platform
+	started  time.Time
+
+	mu    sync.Mutex
+	tasks map[string]*TaskRecord
+}
+
+// NewRecorder creates a recorder for a run on the given platform
+func NewRecorder(p platform.Platform) *Recorder {
+	return &Recorder{
+		platform: p,
+		started:  time.Now(),
+		tasks:    make(map[string]*TaskRecord),
+	}
+}
+
+// Fixture returns what has been recorded, with tasks sorted by name
+func (r *Recorder) Fixture() *Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f := &Fixture{
+		Version:  FixtureVersion,
+		Recorded: r.started.UTC().Truncate(time.Second),
+		Platform: r.platform,
+		Tasks:    make([]TaskRecord, 0, len(r.tasks)),
+	}
+	for _, rec := range r.tasks {
+		f.Tasks = append(f.Tasks, *rec)
+	}
+	sort.Slice(f.Tasks, func(i, j int) bool {
+		return f.Tasks[i].Name < f.Tasks[j].Name
+	})
+	for i := range f.Tasks {
+		f.Tasks[i] = r.redacted(f.Tasks[i])
+	}
+	f.index()
+	return f
+}
+
+// update calls fn with the record of a task, creating it if needed
+func (r *Recorder) update(task Task, fn func(rec *TaskRecord)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tasks == nil {
+		r.tasks = make(map[string]*TaskRecord)
+	}
+	rec, ok := r.tasks[task.Name]
+	if !ok {
+		rec = &TaskRecord{Name: task.Name, Command: task.Command}
+		r.tasks[task.Name] = rec
+	}
+	fn(rec)
+}
+
+// redacted returns a copy of a task record with its output redacted
+func (r *Recorder) redacted(rec TaskRecord) TaskRecord {
+	if r.Redact == nil {
+		return rec
+	}
+	rec.Command = r.text(rec.Name, rec.Command)
+	rec.Error = r.text(rec.Name, rec.Error)
+	if rec.Attempts != nil {
+		attempts := make([]CommandRecord, len(rec.Attempts))
+		for i, attempt := range rec.Attempts {
+			attempt.Stdout = r.text(rec.Name, attempt.Stdout)
+			attempt.Stderr = r.text(rec.Name, attempt.Stderr)
+			attempts[i] = attempt
+		}
+		rec.Attempts = attempts
+	}
+	if rec.Collection != nil {
+		collection := *rec.Collection
+		collection.Text = r.text(rec.Name, collection.Text)
+		collection.Fields = r.record(rec.Name, collection.Fields)
+		if collection.Records != nil {
+			records := make([]Record, len(collection.Records))
+			for i, record := range collection.Records {
+				records[i] = r.record(rec.Name, record)
+			}
+			collection.Records = records
+		}
+		rec.Collection = &collection
+	}
+	return rec
+}
+
+// text redacts a recorded value
+func (r *Recorder) text(taskName, text string) string {
+	if r.Redact == nil {
+		return text
+	}
+	return r.Redact(taskName, text)
+}
+
+// skipped records that a task was not started
+func (r *Recorder) skipped(task Task, reason string) {
+	r.update(task, func(rec *TaskRecord) {
+		rec.SkipReason = reason
+	})
+}
+
+// cancelled records that the run ended before a task did
+func (r *Recorder) cancelled(task Task) {
+	r.update(task, func(rec *TaskRecord) {
+		rec.Cancelled = true
+	})
+}
+
+// command records one attempt at running a task's command
+func (r *Recorder) command(task Task, attempt CommandRecord) {
+	r.update(task, func(rec *TaskRecord) {
+		rec.Attempts = append(rec.Attempts, attempt)
+	})
+}
+
+// collected records the outcome of a collector task
+func (r *Recorder) collected(task Task, collection Collection, err error) {
+	r.update(task, func(rec *TaskRecord) {
+		if err != nil {
+			rec.Error = err.Error()
+			return
+		}
+		rec.Collection = &collection
+	})
+}
+
+// record redacts the string values of a collector record
+func (r *Recorder) record(taskName string, record Record) Record {
+	if record == nil || r.Redact == nil {
+		return record
+	}
+	redacted := make(Record, len(record))
+	for key, value := range record {
+		if s, ok := value.(string); ok {
+			value = r.Redact(taskName, s)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// escalated records a task run by the escalation helper. Only its final
+// result is known, so it is kept as a single attempt.
+func (r *Recorder) escalated(task Task, result TaskResult) {
+	if result.Status == StatusCancelled {
+		r.cancelled(task)
+		return
+	}
+	r.command(task, CommandRecord{
+		Stdout:      result.Output,
+		Stderr:      result.Error,
+		StdoutBytes: result.StdoutSize,
+		StderrBytes: result.StderrSize,
+		ExitCode:    result.ExitCode,
+		Signal:      result.Signal,
+		TimedOut:    result.Status == StatusTimedOut,
+		DurationMS:  float64(result.Duration) / float64(time.Millisecond),
+	})
+	r.update(task, func(rec *TaskRecord) {
+		rec.Escalated = result.Escalated
+	})
+}
@@ -0,0 +1,180 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// fixtureTasks exercise each way a task can end
+var fixtureTasks = []Task{
+	{Name: "Output", Command: "echo hello; echo warning >&2"},
+	{Name: "Expected Exit Code", Command: "echo inactive; exit 3", OkExitCodes: []int{0, 3}},
+	{Name: "Failure", Command: "echo broken >&2; exit 2", Retries: 1},
+	{Name: "Empty", Command: "true", EmptyIs: EmptyIsSkipped},
+	{Name: "Truncated", Command: "seq 1 100", MaxLines: 10},
+	{Name: "Timeout", Command: "echo started; sleep 5", Timeout: 100 * time.Millisecond},
+	{Name: "Missing Binary", Command: "no-such-binary", Requires: []string{"no-such-binary"}},
+	{Name: "Memory", Collector: "meminfo"},
+	{ID: "first", Name: "Exporter", Command: "echo 'count: 42'", Exports: map[string]string{"count": `^count: (\d+)$`}},
+	{Name: "Dependent", Command: "echo {{first.count}}", DependsOn: []string{"first"}},
+}
+
+// TestFixtureReplay records a run, saves and loads the fixture, and checks
+// that replaying it gives the same results without running anything
+func TestFixtureReplay(t *testing.T) {
+	plat := platform.Platform{OS: "linux", Distro: "arch", DistroID: "arch_linux"}
+	root := fstest.MapFS{
+		"proc/meminfo": {Data: []byte("MemTotal: 16384000 kB\nMemAvailable: 8192000 kB\nSwapTotal: 0 kB\n")},
+	}
+
+	recording := NewRunner(plat)
+	recording.Root = root
+	recording.Recorder = NewRecorder(plat)
+	recorded := NewPool(recording, DefaultWorkers).Run(context.Background(), fixtureTasks)
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := recording.Recorder.Fixture().Save(path); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commands that would fail if they ran show that nothing is executed
+	replaying := NewRunner(fixture.Platform)
+	replaying.Root = fstest.MapFS{}
+	replaying.Replay = fixture
+	tasks := make([]Task, len(fixtureTasks))
+	for i, task := range fixtureTasks {
+		if task.Command != "" {
+			task.Command = "exit 99"
+		}
+		tasks[i] = task
+	}
+	tasks[len(tasks)-1].Command = "echo {{first.count}}"
+	replayed := NewPool(replaying, DefaultWorkers).Run(context.Background(), tasks)
+
+	for i, want := range recorded {
+		got := replayed[i]
+		if got.Status != want.Status || got.Output != want.Output || got.Error != want.Error ||
+			got.ExitCode != want.ExitCode || got.Signal != want.Signal || got.SkipReason != want.SkipReason ||
+			got.Attempts != want.Attempts || got.StdoutSize != want.StdoutSize || got.StderrSize != want.StderrSize {
+			t.Errorf("%s: replayed\n  %+v\nrecorded\n  %+v", want.Name, got, want)
+		}
+		if gotFields, wantFields := jsonString(t, got.Fields), jsonString(t, want.Fields); gotFields != wantFields {
+			t.Errorf("%s: replayed fields %s, recorded %s", want.Name, gotFields, wantFields)
+		}
+	}
+
+	// Spot checks that the recording saw what each task is meant to cover
+	byName := make(map[string]TaskResult)
+	for _, r := range replayed {
+		byName[r.Name] = r
+	}
+	checks := []struct {
+		name   string
+		status Status
+	}{
+		{"Output", StatusSuccess},
+		{"Expected Exit Code", StatusSuccess},
+		{"Failure", StatusFailed},
+		{"Empty", StatusSkipped},
+		{"Truncated", StatusSuccess},
+		{"Timeout", StatusTimedOut},
+		{"Missing Binary", StatusSkipped},
+		{"Memory", StatusSuccess},
+		{"Dependent", StatusSuccess},
+	}
+	for _, c := range checks {
+		if got := byName[c.name].Status; got != c.status {
+			t.Errorf("%s: status %s, want %s", c.name, got, c.status)
+		}
+	}
+	if got := byName["Failure"].Attempts; got != 2 {
+		t.Errorf("Failure: %d attempts, want 2", got)
+	}
+	if got := byName["Dependent"].Output; got != "42" {
+		t.Errorf("Dependent: output %q, want 42", got)
+	}
+	if !strings.Contains(byName["Truncated"].Output, "[truncated: exceeded 10 lines]") {
+		t.Errorf("Truncated: output not truncated:\n%s", byName["Truncated"].Output)
+	}
+}
+
+// TestFixtureReplayChangedTask checks that recorded output is judged by the
+// task as it is now, and that tasks missing from the fixture are skipped
+func TestFixtureReplayChangedTask(t *testing.T) {
+	fixture := &Fixture{
+		Version: FixtureVersion,
+		Tasks: []TaskRecord{
+			{Name: "Service", Attempts: []CommandRecord{{Stdout: "inactive\n", StdoutBytes: 9, ExitCode: 3}}},
+		},
+	}
+	runner := NewRunner(platform.Platform{})
+	runner.Replay = fixture
+
+	result := runner.Run(context.Background(), Task{Name: "Service", Command: "systemctl is-active x"})
+	if result.Status != StatusFailed || result.Error != "exit status 3" {
+		t.Errorf("without ok_exit_codes: %s (%s), want failed", result.Status, result.Error)
+	}
+
+	result = runner.Run(context.Background(), Task{Name: "Service", Command: "systemctl is-active x", OkExitCodes: []int{0, 3}})
+	if result.Status != StatusSuccess || result.Output != "inactive" {
+		t.Errorf("with ok_exit_codes: %s %q, want success", result.Status, result.Output)
+	}
+
+	result = runner.Run(context.Background(), Task{Name: "New Task", Command: "true"})
+	if result.Status != StatusSkipped || result.SkipReason != "Not recorded in fixture" {
+		t.Errorf("unrecorded task: %s (%s), want skipped", result.Status, result.SkipReason)
+	}
+}
+
+// TestRecorderRedact checks that recorded output goes through Recorder.Redact
+func TestRecorderRedact(t *testing.T) {
+	runner := NewRunner(platform.Platform{})
+	runner.Recorder = NewRecorder(runner.Platform)
+	runner.Recorder.Redact = func(_, text string) string {
+		return strings.ReplaceAll(text, "secret", "[secret-1]")
+	}
+	runner.Run(context.Background(), Task{Name: "Token", Command: "echo token=secret"})
+
+	rec, ok := runner.Recorder.Fixture().Lookup("Token")
+	if !ok || len(rec.Attempts) != 1 {
+		t.Fatalf("Token: not recorded: %+v", rec)
+	}
+	if got := rec.Attempts[0].Stdout; got != "token=[secret-1]\n" {
+		t.Errorf("recorded stdout %q, want it redacted", got)
+	}
+	if got := rec.Command; got != "echo token=[secret-1]" {
+		t.Errorf("recorded command %q, want it redacted", got)
+	}
+}
+
+// jsonString encodes v, so that values read back from JSON compare equal
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestRecorderZeroValue records into a Recorder that was not created with
+// NewRecorder
+func TestRecorderZeroValue(t *testing.T) {
+	var r Recorder
+	r.skipped(Task{Name: "Skipped", Command: "true"}, "not needed")
+	f := r.Fixture()
+	if len(f.Tasks) != 1 || f.Tasks[0].SkipReason != "not needed" {
+		t.Errorf("fixture %+v", f)
+	}
+}
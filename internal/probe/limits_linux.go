@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+// I/O scheduling constants from linux/ioprio.h, which x/sys does not define
+const (
+	ioprioWhoProcess = 1
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// limitGateExitCode is the shell's exit code if its limits could not be set
+const limitGateExitCode = 125
+
+// startCommand starts cmd with the task's resource limits applied. The shell
+// waits on a pipe until its priorities and rlimits are set, so that every
+// process it starts inherits them.
+func startCommand(cmd *exec.Cmd, task Task) error {
+	if !task.hasLimits() {
+		return cmd.Start()
+	}
+
+	gate, release, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer release.Close()
+
+	// The gate is fd 3 in the shell
+	cmd.ExtraFiles = append(cmd.ExtraFiles, gate)
+	script := cmd.Args[len(cmd.Args)-1]
+	cmd.Args[len(cmd.Args)-1] = fmt.Sprintf("read -r REPLY <&3 || exit %d; exec 3<&-\n%s", limitGateExitCode, script)
+
+	err = cmd.Start()
+	gate.Close()
+	if err != nil {
+		return err
+	}
+
+	// Closing the gate without writing makes the shell exit
+	if err := setLimits(cmd.Process.Pid, task); err != nil {
+		release.Close()
+		_ = cmd.Wait()
+		return fmt.Errorf("setting resource limits: %w", err)
+	}
+	_, err = release.Write([]byte("\n"))
+	return err
+}
+
+// setLimits applies the task's limits to a running process
+func setLimits(pid int, task Task) error {
+	if task.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, pid, task.Nice); err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+	}
+
+	if task.IONice != "" {
+		class, level, _ := parseIONice(task.IONice)
+		prio := ioprioClassIdle << ioprioClassShift
+		if class == IONiceBestEffort {
+			prio = ioprioClassBE<<ioprioClassShift | level
+		}
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(prio)); errno != 0 {
+			return fmt.Errorf("ionice: %w", errno)
+		}
+	}
+
+	if task.MaxMemory > 0 {
+		limit := &unix.Rlimit{Cur: uint64(task.MaxMemory), Max: uint64(task.MaxMemory)}
+		if err := unix.Prlimit(pid, unix.RLIMIT_AS, limit, nil); err != nil {
+			return fmt.Errorf("max_memory: %w", err)
+		}
+	}
+
+	return nil
+}
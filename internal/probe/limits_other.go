@@ -0,0 +1,10 @@
+//go:build !linux
+
+package probe
+
+import "os/exec"
+
+// startCommand starts cmd. Resource limits are only applied on Linux.
+func startCommand(cmd *exec.Cmd, task Task) error {
+	return cmd.Start()
+}
@@ -0,0 +1,470 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+	"gopkg.in/yaml.v3"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// KnownCategories are the categories of the embedded manifests. Reports
+// group tasks by category, so a new one is more often a typo than intended.
+var KnownCategories = []string{
+	"intro", "system", "hardware", "services", "logs", "environment",
+	"graphics", "wm", "audio", "boot", "network", "bluetooth", "power", "packages", "storage",
+}
+
+// Severity is how serious a lint finding is
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // the manifest loads but probably misbehaves
+	SeverityError                   // the manifest does not load or a task cannot work
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Finding is a problem found in a manifest by Lint
+type Finding struct {
+	Path     string
+	Line     int // 0 if the problem concerns the whole file
+	Column   int // 0 if unknown
+	Severity Severity
+	Message  string
+}
+
+// String formats the finding as path:line:column: severity: message
+func (f Finding) String() string {
+	pos := f.Path
+	if f.Line > 0 {
+		pos += fmt.Sprintf(":%d", f.Line)
+		if f.Column > 0 {
+			pos += fmt.Sprintf(":%d", f.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, f.Severity, f.Message)
+}
+
+// lintedManifest is a manifest that decoded, kept for checks across files
+type lintedManifest struct {
+	path    string
+	profile Profile
+	nodes   []*yaml.Node // per task
+}
+
+// linter collects the findings for one source
+type linter struct {
+	findings  []Finding
+	manifests []lintedManifest
+}
+
+// Lint checks manifests for problems the loader does not reject: besides
+// decoding and validation errors, it reports duplicate task and check
+// names, unknown tags and categories, shell syntax errors, and binaries a
+// command runs without listing them in requires. Files are read from
+// source; paths in findings are joined to dir, which names the source for
+// the user. If files is empty, every *.yaml file in source is checked.
+func Lint(source fs.FS, dir string, files []string) ([]Finding, error) {
+	if len(files) == 0 {
+		err := fs.WalkDir(source, ".", func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(p, ".yaml") {
+				files = append(files, p)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l := &linter{}
+	for _, file := range files {
+		data, err := fs.ReadFile(source, file)
+		if err != nil {
+			return nil, err
+		}
+		l.lintFile(path.Join(dir, file), data)
+	}
+	l.checkCollisions()
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.findings, nil
+}
+
+// report adds a finding at the position of a node
+func (l *linter) report(file string, n *yaml.Node, severity Severity, format string, args ...any) {
+	f := Finding{Path: file, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		f.Line, f.Column = n.Line, n.Column
+	}
+	l.findings = append(l.findings, f)
+}
+
+// lintFile checks a single manifest
+func (l *linter) lintFile(file string, data []byte) {
+	profile, doc, err := decodeProfile(data)
+	if err != nil {
+		_ = eachError(err, func(err error) error {
+			f := Finding{Path: file, Severity: SeverityError, Message: err.Error()}
+			var merr *ManifestError
+			if errors.As(err, &merr) {
+				f.Line, f.Column, f.Message = merr.Line, merr.Column, merr.Msg
+			}
+			l.findings = append(l.findings, f)
+			return err
+		})
+		return
+	}
+
+	lines := strings.Split(string(data), "\n")
+	nodes := taskNodes(doc)
+	seen := make(map[string]*yaml.Node)
+
+	for i, task := range profile.Tasks {
+		n := nodes[i]
+
+		if task.Name == "" {
+			l.report(file, n, SeverityError, "task has no name")
+			continue
+		}
+		if first, ok := seen[task.Name]; ok {
+			l.report(file, n, SeverityError, "duplicate task name %q (first at line %d)", task.Name, first.Line)
+		} else {
+			seen[task.Name] = n
+		}
+		if err := task.validate(); err != nil {
+			l.report(file, n, SeverityError, "%v", err)
+		}
+		if task.Disabled {
+			continue
+		}
+		if task.Command == "" && task.Collector == "" {
+			l.report(file, n, SeverityError, "task %q has neither command nor collector", task.Name)
+		}
+
+		for j, tag := range task.Tags {
+			if !slices.Contains(platform.KnownTags, strings.ToLower(tag)) {
+				l.report(file, fieldNode(n, "tags").Content[j], SeverityWarning, "task %q: unknown tag %q (known: %s)", task.Name, tag, strings.Join(platform.KnownTags, ", "))
+			}
+		}
+
+		// Tasks without a category take the file's, or the one of the task
+		// they override, so only explicit ones are checked
+		if task.Category != "" && !slices.Contains(KnownCategories, task.Category) {
+			l.report(file, fieldNode(n, "category"), SeverityWarning, "task %q: unknown category %q (known: %s)", task.Name, task.Category, strings.Join(KnownCategories, ", "))
+		}
+
+		if task.Command != "" {
+			l.lintCommand(file, task, fieldNode(n, "command"), lines)
+		}
+	}
+
+	checks := checkNodes(doc)
+	seenChecks := make(map[string]*yaml.Node)
+	for i, check := range profile.Checks {
+		n := checks[i]
+		if first, ok := seenChecks[check.Name]; ok && check.Name != "" {
+			l.report(file, n, SeverityError, "duplicate check name %q (first at line %d)", check.Name, first.Line)
+		} else {
+			seenChecks[check.Name] = n
+		}
+		if err := check.validate(); err != nil {
+			l.report(file, n, SeverityError, "%v", err)
+		}
+	}
+
+	l.manifests = append(l.manifests, lintedManifest{path: file, profile: profile, nodes: nodes})
+}
+
+// lintCommand parses a task's command as a POSIX shell script, which is
+// what `sh -c` accepts, and checks the binaries it runs
+func (l *linter) lintCommand(file string, task Task, n *yaml.Node, lines []string) {
+	script, err := syntax.NewParser(syntax.Variant(syntax.LangPOSIX)).Parse(strings.NewReader(task.Command), "")
+	if err != nil {
+		var pos syntax.Pos
+		msg := err.Error()
+		var parseErr syntax.ParseError
+		var langErr syntax.LangError
+		switch {
+		case errors.As(err, &parseErr):
+			pos, msg = parseErr.Pos, parseErr.Text
+		case errors.As(err, &langErr):
+			pos = langErr.Pos
+			msg = strings.TrimPrefix(langErr.Error(), pos.String()+": ")
+		}
+		l.report(file, commandPos(n, pos, lines), SeverityError, "task %q: shell syntax: %s", task.Name, msg)
+		return
+	}
+
+	reported := make(map[string]bool)
+	for _, call := range unguardedCalls(script) {
+		if reported[call.name] || slices.Contains(task.Requires, call.name) {
+			continue
+		}
+		reported[call.name] = true
+		l.report(file, commandPos(n, call.pos, lines), SeverityWarning,
+			"task %q runs %s, which is not in requires; where it is missing the task fails instead of being skipped", task.Name, call.name)
+	}
+}
+
+// commandPos returns a node positioned at pos in a command, translating the
+// script's line and column to the manifest's
+func commandPos(n *yaml.Node, pos syntax.Pos, lines []string) *yaml.Node {
+	if !pos.IsValid() {
+		return n
+	}
+	line, col := int(pos.Line()), int(pos.Col())
+	if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		// Block scalars start on the line after the indicator
+		at := n.Line + line
+		indent := 0
+		if n.Line < len(lines) {
+			first := lines[n.Line]
+			indent = len(first) - len(strings.TrimLeft(first, " "))
+		}
+		return &yaml.Node{Line: at, Column: indent + col}
+	}
+	if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		col++
+	}
+	if line > 1 {
+		return &yaml.Node{Line: n.Line + line - 1, Column: col}
+	}
+	return &yaml.Node{Line: n.Line, Column: n.Column + col - 1}
+}
+
+// shellCall is a command run by a script
+type shellCall struct {
+	name string
+	pos  syntax.Pos
+}
+
+// baseCommands are shell builtins and the tools every supported system has:
+// coreutils, grep, sed, awk and findutils
+var baseCommands = []string{
+	// Builtins
+	".", ":", "[", "alias", "break", "cd", "command", "continue", "echo", "eval", "exec", "exit",
+	"export", "false", "getopts", "hash", "kill", "local", "printf", "pwd", "read", "readonly",
+	"return", "set", "shift", "test", "trap", "true", "type", "ulimit", "umask", "unset", "wait",
+	// coreutils
+	"basename", "cat", "comm", "cut", "date", "df", "dirname", "du", "env", "expr", "fold", "head",
+	"id", "join", "ls", "md5sum", "mkdir", "mktemp", "nice", "nohup", "nproc", "numfmt", "od",
+	"paste", "printenv", "readlink", "realpath", "seq", "sha256sum", "sleep", "sort", "stat",
+	"stdbuf", "tac", "tail", "tee", "timeout", "touch", "tr", "tty", "uname", "uniq", "wc", "whoami",
+	// Text tools
+	"grep", "egrep", "fgrep", "sed", "awk", "find", "xargs",
+}
+
+// wrapperArgs lists, for commands that run another command, the options
+// that take a separate argument
+var wrapperArgs = map[string][]string{
+	"env":     {"-u", "-C"},
+	"exec":    {"-a"},
+	"nice":    {"-n"},
+	"nohup":   {},
+	"stdbuf":  {"-i", "-o", "-e"},
+	"timeout": {"-s", "-k"},
+	"xargs":   {"-I", "-n", "-d", "-P", "-L", "-s", "-E", "-a"},
+}
+
+// unguardedCalls returns the commands a script runs that are not builtins
+// or base tools, skipping those whose absence the script handles itself:
+// calls on the left of ||, in if and while conditions or with stderr sent to
+// /dev/null, and names checked with command -v, which, type or hash
+func unguardedCalls(script *syntax.File) []shellCall {
+	guarded := make(map[*syntax.CallExpr]bool)
+	checked := make(map[string]bool)
+	defined := make(map[string]bool)
+
+	guard := func(n syntax.Node) {
+		syntax.Walk(n, func(n syntax.Node) bool {
+			if call, ok := n.(*syntax.CallExpr); ok {
+				guarded[call] = true
+			}
+			return true
+		})
+	}
+	syntax.Walk(script, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.BinaryCmd:
+			if n.Op == syntax.OrStmt {
+				guard(n.X)
+			}
+		case *syntax.IfClause:
+			for _, s := range n.Cond {
+				guard(s)
+			}
+		case *syntax.WhileClause:
+			for _, s := range n.Cond {
+				guard(s)
+			}
+		case *syntax.Stmt:
+			if silencesErrors(n) {
+				guard(n.Cmd)
+			}
+		case *syntax.FuncDecl:
+			defined[n.Name.Value] = true
+		case *syntax.CallExpr:
+			args := literalArgs(n)
+			if len(args) < 2 {
+				break
+			}
+			switch args[0] {
+			case "command":
+				if args[1] == "-v" || args[1] == "-V" {
+					for _, name := range args[2:] {
+						checked[name] = true
+					}
+				}
+			case "which", "type", "hash":
+				for _, name := range args[1:] {
+					checked[name] = true
+				}
+			}
+		}
+		return true
+	})
+
+	var calls []shellCall
+	syntax.Walk(script, func(n syntax.Node) bool {
+		call, ok := n.(*syntax.CallExpr)
+		if !ok || guarded[call] {
+			return true
+		}
+		if name, pos := calledCommand(call); name != "" && !defined[name] && !checked[name] && !slices.Contains(baseCommands, name) {
+			calls = append(calls, shellCall{name, pos})
+		}
+		return true
+	})
+	return calls
+}
+
+// silencesErrors reports whether a statement sends stderr to /dev/null,
+// which is how manifests mark commands that may be missing
+func silencesErrors(stmt *syntax.Stmt) bool {
+	for _, r := range stmt.Redirs {
+		if r.Word == nil || r.Word.Lit() != "/dev/null" {
+			continue
+		}
+		if r.Op == syntax.RdrAll || r.Op == syntax.AppAll || (r.Op == syntax.RdrOut || r.Op == syntax.AppOut) && r.N != nil && r.N.Value == "2" {
+			return true
+		}
+	}
+	return false
+}
+
+// literalArgs returns the words of a call up to the first one that is not
+// a literal
+func literalArgs(call *syntax.CallExpr) []string {
+	var args []string
+	for _, w := range call.Args {
+		lit := w.Lit()
+		if lit == "" {
+			break
+		}
+		args = append(args, lit)
+	}
+	return args
+}
+
+// calledCommand returns the binary a call runs, looking through wrappers
+// such as timeout and xargs, or "" if it is not a literal name. Paths such
+// as ./script or /usr/bin/foo are not looked up on PATH, so they are
+// ignored too.
+func calledCommand(call *syntax.CallExpr) (string, syntax.Pos) {
+	args := call.Args
+	for len(args) > 0 {
+		name := args[0].Lit()
+		if name == "" || strings.Contains(name, "/") {
+			return "", syntax.Pos{}
+		}
+		if _, wrapper := wrapperArgs[name]; !wrapper {
+			return name, args[0].Pos()
+		}
+		args = skipWrapperArgs(name, args[1:])
+	}
+	return "", syntax.Pos{}
+}
+
+// skipWrapperArgs skips a wrapper's options, timeout's duration and env's
+// assignments, returning the wrapped command and its arguments
+func skipWrapperArgs(wrapper string, args []*syntax.Word) []*syntax.Word {
+	for len(args) > 0 {
+		arg := args[0].Lit()
+		switch {
+		case strings.HasPrefix(arg, "-"):
+			if slices.Contains(wrapperArgs[wrapper], arg) && len(args) > 1 {
+				args = args[1:]
+			}
+		case wrapper == "env" && strings.Contains(arg, "="):
+		case wrapper == "timeout":
+			return args[1:]
+		default:
+			return args
+		}
+		args = args[1:]
+	}
+	return args
+}
+
+// checkCollisions reports tasks with the same name in different manifests
+// that load on the same system. Unlike overrides from a later source, both
+// are run, and the UI, which tracks tasks by name, shows only one.
+func (l *linter) checkCollisions() {
+	type definition struct {
+		manifest *lintedManifest
+		node     *yaml.Node
+	}
+	byName := make(map[string][]definition)
+
+	for m := range l.manifests {
+		manifest := &l.manifests[m]
+		for i, task := range manifest.profile.Tasks {
+			if task.Name == "" || task.Disabled {
+				continue
+			}
+			for _, other := range byName[task.Name] {
+				if other.manifest.path != manifest.path && loadTogether(other.manifest.profile, manifest.profile) {
+					l.report(manifest.path, manifest.nodes[i], SeverityError,
+						"task %q is also defined at %s:%d and both load on the same system; the UI tracks tasks by name and shows only one", task.Name, other.manifest.path, other.node.Line)
+					break
+				}
+			}
+			byName[task.Name] = append(byName[task.Name], definition{manifest, manifest.nodes[i]})
+		}
+	}
+}
+
+// loadTogether reports whether two manifests can match the same platform
+func loadTogether(a, b Profile) bool {
+	if a.isGeneric() || b.isGeneric() {
+		return true
+	}
+	for _, id := range append(append([]string{}, a.Platform...), a.PlatformLike...) {
+		if slices.Contains(b.Platform, id) || slices.Contains(b.PlatformLike, id) {
+			return true
+		}
+	}
+	return false
+}
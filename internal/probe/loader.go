@@ -1,35 +1,94 @@
 package probe
 
 import (
-	"embed"
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pkrzeminski/sysprobe/internal/platform"
-	"gopkg.in/yaml.v3"
 )
 
 // Loader handles loading and filtering probe profiles
 type Loader struct {
-	fs       embed.FS
+	sources  []fs.FS
 	platform platform.Platform
 }
 
-// NewLoader creates a new probe loader
-func NewLoader(probeFS embed.FS, p platform.Platform) *Loader {
+// NewLoader creates a new probe loader.
+// Sources are merged in order: a task in a later source replaces (or, with
+// `disabled: true`, removes) any task with the same name from an earlier one.
+func NewLoader(sources []fs.FS, p platform.Platform) *Loader {
 	return &Loader{
-		fs:       probeFS,
+		sources:  sources,
 		platform: p,
 	}
 }
 
+// UserProbeDirs returns the on-disk overlay directories, lowest precedence first
+func UserProbeDirs() []string {
+	dirs := []string{"/etc/sysprobe/probes.d"}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "sysprobe", "probes.d"))
+	}
+	return dirs
+}
+
+// DirSources returns a filesystem for every directory in dirs that exists
+func DirSources(dirs ...string) []fs.FS {
+	var sources []fs.FS
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			sources = append(sources, os.DirFS(dir))
+		}
+	}
+	return sources
+}
+
 // LoadAll loads all profiles that match the current platform
 func (l *Loader) LoadAll() ([]Profile, error) {
 	var profiles []Profile
 
-	err := fs.WalkDir(l.fs, "probes", func(path string, d fs.DirEntry, err error) error {
+	for s, source := range l.sources {
+		loaded, err := l.loadSource(source)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only tasks from earlier sources can be overridden; two tasks with
+		// the same name in one source are both kept
+		earlier := len(profiles)
+
+		for _, profile := range loaded {
+			// Check if profile matches current platform
+			if !l.matchesPlatform(profile) {
+				continue
+			}
+
+			profile.source = s
+			profile.Tasks = overrideTasks(profiles[:earlier], profile.Tasks)
+
+			// Set category from filename if not specified in tasks
+			for i := range profile.Tasks {
+				if profile.Tasks[i].Category == "" {
+					profile.Tasks[i].Category = profile.category
+				}
+			}
+
+			profiles = append(profiles, profile)
+		}
+	}
+
+	return profiles, nil
+}
+
+// loadSource reads every YAML profile in a single source
+func (l *Loader) loadSource(source fs.FS) ([]Profile, error) {
+	var profiles []Profile
+
+	err := fs.WalkDir(source, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -38,69 +97,120 @@ func (l *Loader) LoadAll() ([]Profile, error) {
 			return nil
 		}
 
-		profile, err := l.loadProfile(path)
+		profile, err := l.loadProfile(source, path)
 		if err != nil {
-			return fmt.Errorf("loading %s: %w", path, err)
-		}
-
-		// Check if profile matches current platform
-		if l.matchesPlatform(profile) {
-			profiles = append(profiles, profile)
+			return eachError(err, func(err error) error {
+				return fmt.Errorf("loading %s: %w", path, err)
+			})
 		}
 
+		profiles = append(profiles, profile)
 		return nil
 	})
 
+	// Shared packs come first so distro-specific tasks follow them
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].isGeneric() && !profiles[j].isGeneric()
+	})
+
 	return profiles, err
 }
 
 // loadProfile reads and parses a single YAML profile
-func (l *Loader) loadProfile(path string) (Profile, error) {
-	var profile Profile
-
-	data, err := l.fs.ReadFile(path)
+func (l *Loader) loadProfile(source fs.FS, path string) (Profile, error) {
+	data, err := fs.ReadFile(source, path)
 	if err != nil {
-		return profile, err
+		return Profile{}, err
 	}
 
-	if err := yaml.Unmarshal(data, &profile); err != nil {
+	profile, doc, err := decodeProfile(data)
+	if err != nil {
 		return profile, err
 	}
 
-	// Set category from filename if not specified in tasks
-	category := strings.TrimSuffix(filepath.Base(path), ".yaml")
-	for i := range profile.Tasks {
-		if profile.Tasks[i].Category == "" {
-			profile.Tasks[i].Category = category
+	profile.category = strings.TrimSuffix(filepath.Base(path), ".yaml")
+
+	nodes := taskNodes(doc)
+	for i, task := range profile.Tasks {
+		if err := task.validate(); err != nil {
+			return profile, nodeError(nodes[i], "%v", err)
+		}
+	}
+	nodes = checkNodes(doc)
+	for i, check := range profile.Checks {
+		if err := check.validate(); err != nil {
+			return profile, nodeError(nodes[i], "%v", err)
 		}
 	}
 
 	return profile, nil
 }
 
-// matchesPlatform checks if a profile matches the current platform
-func (l *Loader) matchesPlatform(profile Profile) bool {
-	if profile.Platform == "" {
-		return true
+// overrideTasks applies tasks from a later source to the already loaded
+// profiles. Tasks whose name matches an earlier task replace it in place
+// (keeping its category and id unless given) or remove it when disabled.
+// The remaining, new tasks are returned.
+func overrideTasks(profiles []Profile, tasks []Task) []Task {
+	var remaining []Task
+
+	for _, task := range tasks {
+		matched := false
+
+		for p := range profiles {
+			existing := profiles[p].Tasks[:0]
+			for _, old := range profiles[p].Tasks {
+				if old.Name != task.Name {
+					existing = append(existing, old)
+					continue
+				}
+
+				matched = true
+				if task.Disabled {
+					continue
+				}
+
+				replacement := task
+				if replacement.Category == "" {
+					replacement.Category = old.Category
+				}
+				if replacement.ID == "" {
+					replacement.ID = old.ID
+				}
+				existing = append(existing, replacement)
+			}
+			profiles[p].Tasks = existing
+		}
+
+		if !matched && !task.Disabled {
+			remaining = append(remaining, task)
+		}
 	}
 
-	// Normalize platform strings for comparison
-	profilePlatform := strings.ToLower(profile.Platform)
-	currentPlatform := strings.ToLower(l.platform.DistroID)
+	return remaining
+}
 
-	// Direct match
-	if profilePlatform == currentPlatform {
+// matchesPlatform checks if a profile matches the current platform
+func (l *Loader) matchesPlatform(profile Profile) bool {
+	if len(profile.Platform) == 0 && len(profile.PlatformLike) == 0 {
 		return true
 	}
 
-	// Partial match (e.g., "arch" matches "arch_linux")
-	if strings.Contains(currentPlatform, profilePlatform) {
-		return true
+	for _, id := range profile.Platform {
+		// Generic linux match
+		if strings.EqualFold(id, "linux") && l.platform.OS == "linux" {
+			return true
+		}
+
+		if l.platform.Is(id) {
+			return true
+		}
 	}
 
-	// Generic linux match
-	if profilePlatform == "linux" && l.platform.OS == "linux" {
-		return true
+	// Family match (e.g., "arch" matches EndeavourOS, Manjaro and CachyOS)
+	for _, id := range profile.PlatformLike {
+		if l.platform.IsLike(id) {
+			return true
+		}
 	}
 
 	return false
@@ -130,6 +240,56 @@ func (l *Loader) GetAllTasks() ([]Task, error) {
 		return nil, err
 	}
 
-	return l.FilterTasks(profiles), nil
+	tasks := l.FilterTasks(profiles)
+	if err := checkDependencies(tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
 }
 
+// GetAllChecks loads all matching profiles and returns their checks. As
+// with tasks, a check in a later source replaces, or with `disabled: true`
+// removes, an earlier check of the same name.
+func (l *Loader) GetAllChecks() ([]Check, error) {
+	profiles, err := l.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only checks from earlier sources can be overridden; two checks with
+	// the same name in one source are both kept
+	var checks, added []Check
+	source := -1
+	for _, profile := range profiles {
+		if profile.source != source {
+			checks, added, source = append(checks, added...), nil, profile.source
+		}
+		for _, check := range profile.Checks {
+			var matched bool
+			checks, matched = overrideCheck(checks, check)
+			if !matched && !check.Disabled {
+				added = append(added, check)
+			}
+		}
+	}
+	return append(checks, added...), nil
+}
+
+// overrideCheck applies a check from a later source to the checks of
+// earlier ones, replacing those of the same name in place or removing them
+// when it is disabled. It reports whether any matched.
+func overrideCheck(checks []Check, check Check) ([]Check, bool) {
+	matched := false
+	kept := checks[:0]
+	for _, old := range checks {
+		if old.Name != check.Name {
+			kept = append(kept, old)
+			continue
+		}
+		matched = true
+		if !check.Disabled {
+			kept = append(kept, check)
+		}
+	}
+	return kept, matched
+}
@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// TestLoaderOverrides checks that a later source replaces and disables
+// tasks of earlier ones, while same-named tasks within a source are kept
+func TestLoaderOverrides(t *testing.T) {
+	embedded := fstest.MapFS{
+		"linux/audio.yaml": {Data: []byte("name: Audio\ntasks:\n  - name: PipeWire Status\n    command: pw-cli info\n  - name: ALSA Cards\n    command: aplay -l\n")},
+		"linux/wm.yaml":    {Data: []byte("name: WM\ntasks:\n  - name: PipeWire Status\n    command: systemctl --user status pipewire\n")},
+	}
+	overlay := fstest.MapFS{
+		"local.yaml": {Data: []byte("name: Local\ntasks:\n  - name: ALSA Cards\n    command: aplay -L\n  - name: PipeWire Status\n    disabled: true\n  - name: Extra\n    command: echo extra\n")},
+	}
+
+	tasks, err := NewLoader(nil, platform.Platform{OS: "linux"}).GetAllTasks()
+	if err != nil || len(tasks) != 0 {
+		t.Fatalf("no sources: %v %v", tasks, err)
+	}
+
+	loader := NewLoader([]fs.FS{embedded}, platform.Platform{OS: "linux"})
+	if tasks, err = loader.GetAllTasks(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Errorf("same-named tasks in one source: got %d tasks, want 3", len(tasks))
+	}
+
+	loader = NewLoader([]fs.FS{embedded, overlay}, platform.Platform{OS: "linux"})
+	if tasks, err = loader.GetAllTasks(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Category+"/"+task.Name+": "+task.Command)
+	}
+	want := []string{"audio/ALSA Cards: aplay -L", "local/Extra: echo extra"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("with overlay: got %q, want %q", got, want)
+	}
+}
+
+// TestLoaderCheckOverrides checks that checks follow the same rules as
+// tasks: only a later source overrides a check of the same name
+func TestLoaderCheckOverrides(t *testing.T) {
+	check := func(name, message string) string {
+		return "  - name: " + name + "\n    task: Disk Usage\n    if: contains(\"9\")\n    severity: warning\n    message: " + message + "\n"
+	}
+	embedded := fstest.MapFS{
+		"linux/storage.yaml": {Data: []byte("name: Storage\ntasks:\n  - name: Disk Usage\n    command: df -h\nchecks:\n" +
+			check("disk-full", "root is full") + check("disk-full", "home is full") + check("inode-full", "inodes are used up"))},
+	}
+	overlay := fstest.MapFS{
+		"local.yaml": {Data: []byte("name: Local\nchecks:\n" + check("inode-full", "local inode rule") +
+			"  - name: disk-full\n    disabled: true\n" + check("swap-full", "swap is full"))},
+	}
+
+	checks, err := NewLoader([]fs.FS{embedded}, platform.Platform{OS: "linux"}).GetAllChecks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 3 || checks[0].Message != "root is full" || checks[1].Message != "home is full" {
+		t.Errorf("same-named checks in one source: %+v", checks)
+	}
+
+	checks, err = NewLoader([]fs.FS{embedded, overlay}, platform.Platform{OS: "linux"}).GetAllChecks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, check := range checks {
+		got = append(got, check.Name+": "+check.Message)
+	}
+	want := []string{"inode-full: local inode rule", "swap-full: swap is full"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("with overlay: got %q, want %q", got, want)
+	}
+}
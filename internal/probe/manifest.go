@@ -0,0 +1,241 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestError is a problem at a position in a manifest
+type ManifestError struct {
+	Line, Column int // 1-based; Column is 0 if unknown
+	Msg          string
+}
+
+func (e *ManifestError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// nodeError returns a ManifestError at the position of a YAML node
+func nodeError(n *yaml.Node, format string, args ...any) *ManifestError {
+	return &ManifestError{Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// yamlLine matches the position yaml.v3 puts in front of its messages
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// decodeProfile strictly decodes a manifest: unknown keys, such as a
+// misspelled `max_line:`, are errors rather than ignored. The returned
+// error joins one ManifestError per problem. The parsed document is also
+// returned, so that later checks can report positions.
+func decodeProfile(data []byte) (Profile, *yaml.Node, error) {
+	var profile Profile
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return profile, nil, yamlError(err)
+	}
+	if len(doc.Content) == 0 {
+		return profile, &doc, nil
+	}
+	root := doc.Content[0]
+
+	var errs []error
+	checkFields(root, reflect.TypeOf(profile), "manifest", &errs)
+	if len(errs) > 0 {
+		return profile, &doc, errors.Join(errs...)
+	}
+
+	if err := root.Decode(&profile); err != nil {
+		return profile, &doc, yamlError(err)
+	}
+	return profile, &doc, nil
+}
+
+// yamlError converts the errors of the YAML decoder to ManifestErrors
+func yamlError(err error) error {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	errs := make([]error, 0, len(messages))
+	for _, msg := range messages {
+		m := yamlLine.FindStringSubmatch(msg)
+		if m == nil {
+			errs = append(errs, errors.New(strings.TrimPrefix(msg, "yaml: ")))
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		errs = append(errs, &ManifestError{Line: line, Msg: msg[len(m[0]):]})
+	}
+	return errors.Join(errs...)
+}
+
+// eachError applies wrap to every error joined in err, so that each line of
+// the message gets the same context
+func eachError(err error, wrap func(error) error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return wrap(err)
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, wrap(e))
+	}
+	return errors.Join(errs...)
+}
+
+// unmarshalerType is implemented by types that decode their own YAML
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkFields reports the keys of mappings in n that have no field in t
+func checkFields(n *yaml.Node, t reflect.Type, what string, errs *[]error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				*errs = append(*errs, nodeError(key, "unknown field %q in %s%s", key.Value, what, suggestField(key.Value, fields)))
+				continue
+			}
+			checkFields(value, field.Type, key.Value, errs)
+		}
+
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		// Items of a list are named after the list, e.g. tasks holds tasks
+		item := strings.TrimSuffix(what, "s")
+		for _, child := range n.Content {
+			checkFields(child, t.Elem(), item, errs)
+		}
+
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			checkFields(n.Content[i], t.Elem(), what, errs)
+		}
+	}
+}
+
+// yamlFields returns the exported fields of a struct by their YAML key
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		fields[key] = f
+	}
+	return fields
+}
+
+// suggestField returns a hint naming the known field closest to a
+// misspelled one, or "" if none is close
+func suggestField(key string, fields map[string]reflect.StructField) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := editDistance(key, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// taskNodes returns the YAML node of each task in a parsed manifest, in
+// the order of Profile.Tasks
+func taskNodes(doc *yaml.Node) []*yaml.Node {
+	return listNodes(doc, "tasks")
+}
+
+// checkNodes returns the YAML node of each check in a parsed manifest, in
+// the order of Profile.Checks
+func checkNodes(doc *yaml.Node) []*yaml.Node {
+	return listNodes(doc, "checks")
+}
+
+// listNodes returns the items of a top-level list in a parsed manifest
+func listNodes(doc *yaml.Node, key string) []*yaml.Node {
+	if doc == nil || len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key && root.Content[i+1].Kind == yaml.SequenceNode {
+			return root.Content[i+1].Content
+		}
+	}
+	return nil
+}
+
+// fieldNode returns the value node of a key in a mapping node, or nil
+func fieldNode(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
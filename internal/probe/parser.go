@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Parsed is the structured form of a command's output
+type Parsed struct {
+	Fields  Record   // facts about the output as a whole
+	Records []Record // one entry per line or item, such as a filesystem or a unit
+	Columns []string // keys of the records in the order a table shows them
+}
+
+// Parser turns the text printed by a command into structured fields. It
+// sees the lines of output the report shows, without truncation notes.
+type Parser interface {
+	Parse(output string, args []string) (Parsed, error)
+}
+
+// ParserFunc adapts a function to the Parser interface
+type ParserFunc func(output string, args []string) (Parsed, error)
+
+// Parse calls f
+func (f ParserFunc) Parse(output string, args []string) (Parsed, error) {
+	return f(output, args)
+}
+
+// parsers holds the registered parsers by name
+var parsers = map[string]Parser{}
+
+// RegisterParser makes a parser available to `parser:` in manifests
+func RegisterParser(name string, p Parser) {
+	if _, exists := parsers[name]; exists {
+		panic("probe: parser registered twice: " + name)
+	}
+	parsers[name] = p
+}
+
+// LookupParser returns the parser with the given name
+func LookupParser(name string) (Parser, bool) {
+	p, ok := parsers[name]
+	return p, ok
+}
+
+// ParserNames returns the names of all registered parsers, sorted
+func ParserNames() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkParser validates the parser of a task
+func checkParser(task Task) error {
+	if task.Parser == "" {
+		return nil
+	}
+	if task.Collector != "" {
+		return fmt.Errorf("task %q: parser applies to command output, not to a collector", task.Name)
+	}
+	name, _ := parseCollector(task.Parser)
+	if _, ok := LookupParser(name); !ok {
+		return fmt.Errorf("task %q: unknown parser %q (known: %s)", task.Name, name, strings.Join(ParserNames(), ", "))
+	}
+	return nil
+}
+
+// parseOutput runs the task's parser over the stdout of a successful
+// command. Output beyond max_bytes or max_lines is left out, as it is from
+// the report, including a line cut by max_bytes. Empty output has no
+// fields, and a parser error leaves the result without them; the output is
+// still reported.
+func parseOutput(task Task, stdout string, result TaskResult) TaskResult {
+	result.Fields, result.Records, result.Columns, result.ParseError = nil, nil, nil, ""
+
+	maxBytes := task.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if len(stdout) > maxBytes {
+		stdout = stdout[:maxBytes]
+		stdout = stdout[:strings.LastIndex(stdout, "\n")+1]
+	}
+	maxLines := task.MaxLines
+	if maxLines <= 0 {
+		maxLines = DefaultMaxLines
+	}
+	if lines := strings.SplitAfter(stdout, "\n"); len(lines) > maxLines {
+		stdout = strings.Join(lines[:maxLines], "")
+	}
+	if strings.TrimSpace(stdout) == "" {
+		return result
+	}
+
+	name, args := parseCollector(task.Parser)
+	parser, ok := LookupParser(name)
+	if !ok {
+		result.ParseError = "unknown parser " + name
+		return result
+	}
+	parsed, err := parser.Parse(stdout, args)
+	if err != nil {
+		result.ParseError = err.Error()
+		return result
+	}
+	result.Fields = parsed.Fields
+	result.Records = parsed.Records
+	result.Columns = parsed.Columns
+	return result
+}
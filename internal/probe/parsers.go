@@ -0,0 +1,528 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterParser("df", ParserFunc(parseDF))
+	RegisterParser("lsblk-json", ParserFunc(parseLsblkJSON))
+	RegisterParser("ip-json", ParserFunc(parseIPJSON))
+	RegisterParser("systemctl-units", ParserFunc(parseSystemctlUnits))
+	RegisterParser("journal", ParserFunc(parseJournal))
+	RegisterParser("key-value", ParserFunc(parseKeyValue))
+	RegisterParser("table", ParserFunc(parseTable))
+}
+
+// dfColumns maps df headers to record keys
+var dfColumns = map[string]string{
+	"filesystem": "filesystem",
+	"type":       "type",
+	"size":       "size",
+	"used":       "used",
+	"avail":      "avail",
+	"available":  "avail",
+	"use%":       "use_percent",
+	"capacity":   "use_percent",
+	"inodes":     "inodes",
+	"iused":      "iused",
+	"ifree":      "ifree",
+	"iuse%":      "iuse_percent",
+	"mounted":    "mount",
+}
+
+// parseDF reads the table printed by df, with or without -h, -T, -P or -i.
+// Sizes are kept as printed and, under size_bytes, used_bytes and
+// avail_bytes, as numbers.
+func parseDF(output string, args []string) (Parsed, error) {
+	if err := noArgs("df", args); err != nil {
+		return Parsed{}, err
+	}
+	lines := nonEmptyLines(output)
+	if len(lines) == 0 {
+		return Parsed{}, nil
+	}
+
+	header := strings.Fields(lines[0])
+	if n := len(header); n >= 2 && header[n-2] == "Mounted" && header[n-1] == "on" {
+		header = header[:n-1]
+	}
+	keys := make([]string, len(header))
+	blockSize := int64(1)
+	for i, h := range header {
+		h = strings.ToLower(h)
+		if blocks, ok := strings.CutSuffix(h, "-blocks"); ok {
+			// -k, -P and -B print sizes in blocks such as "1K-blocks"
+			size, ok := parseHumanSize(blocks)
+			if !ok {
+				return Parsed{}, fmt.Errorf("df: unknown block size %q", header[i])
+			}
+			keys[i], blockSize = "size", size
+			continue
+		}
+		key, ok := dfColumns[h]
+		if !ok {
+			return Parsed{}, fmt.Errorf("df: unknown column %q", header[i])
+		}
+		keys[i] = key
+	}
+	if keys[0] != "filesystem" || keys[len(keys)-1] != "mount" {
+		return Parsed{}, errors.New("df: expected a header from Filesystem to Mounted on")
+	}
+
+	var records []Record
+	var pending []string
+	for n, line := range lines[1:] {
+		fields := append(pending, strings.Fields(line)...)
+		pending = nil
+		if len(fields) < len(keys) {
+			// Without -P, a long filesystem name is printed on a line of its own
+			if len(fields) == 1 {
+				pending = fields
+				continue
+			}
+			return Parsed{}, fmt.Errorf("df: line %d has %d columns, want %d", n+2, len(fields), len(keys))
+		}
+
+		record := Record{}
+		for i, key := range keys {
+			value := fields[i]
+			if i == len(keys)-1 {
+				value = strings.Join(fields[i:], " ") // mount points may contain spaces
+			}
+			switch key {
+			case "size", "used", "avail":
+				record[key] = value
+				if size, ok := parseHumanSize(value); ok {
+					record[key+"_bytes"] = size * blockSize
+				}
+			case "inodes", "iused", "ifree":
+				if count, ok := parseHumanSize(value); ok {
+					record[key] = count
+				}
+			case "use_percent", "iuse_percent":
+				if percent, err := strconv.Atoi(strings.TrimSuffix(value, "%")); err == nil {
+					record[key] = percent
+				}
+			default:
+				record[key] = value
+			}
+		}
+		records = append(records, record)
+	}
+
+	return Parsed{Records: records, Columns: keys}, nil
+}
+
+// parseLsblkJSON reads the output of lsblk -J, listing each device once
+// with the name of its parent, in the column order lsblk printed
+func parseLsblkJSON(output string, args []string) (Parsed, error) {
+	if err := noArgs("lsblk-json", args); err != nil {
+		return Parsed{}, err
+	}
+	var doc struct {
+		BlockDevices []json.RawMessage `json:"blockdevices"`
+	}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		return Parsed{}, fmt.Errorf("lsblk-json: %w", err)
+	}
+	if doc.BlockDevices == nil {
+		return Parsed{}, errors.New("lsblk-json: no blockdevices (run lsblk with -J)")
+	}
+
+	var records []Record
+	var columns []string
+	hasParent := false
+	var walk func(devices []json.RawMessage, parent string) error
+	walk = func(devices []json.RawMessage, parent string) error {
+		for _, raw := range devices {
+			keys, err := objectKeys(raw)
+			if err != nil {
+				return err
+			}
+			var device map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &device); err != nil {
+				return err
+			}
+
+			record := Record{}
+			if parent != "" {
+				record["parent"] = parent
+				hasParent = true
+			}
+			for _, key := range keys {
+				if key == "children" {
+					continue
+				}
+				if value, ok := jsonScalar(device[key]); ok {
+					record[key] = value
+					if !slices.Contains(columns, key) {
+						columns = append(columns, key)
+					}
+				}
+			}
+			records = append(records, record)
+
+			if children := device["children"]; children != nil {
+				var list []json.RawMessage
+				if err := json.Unmarshal(children, &list); err != nil {
+					return err
+				}
+				name, _ := record["name"].(string)
+				if err := walk(list, name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(doc.BlockDevices, ""); err != nil {
+		return Parsed{}, fmt.Errorf("lsblk-json: %w", err)
+	}
+
+	if hasParent {
+		at := slices.Index(columns, "name") + 1
+		columns = slices.Insert(columns, at, "parent")
+	}
+	return Parsed{Records: records, Columns: columns}, nil
+}
+
+// ipInterface is an entry of `ip -j addr` or `ip -j link`
+type ipInterface struct {
+	Name     string   `json:"ifname"`
+	State    string   `json:"operstate"`
+	MTU      int      `json:"mtu"`
+	MAC      string   `json:"address"`
+	Master   string   `json:"master"`
+	Flags    []string `json:"flags"`
+	AddrInfo []struct {
+		Local     string `json:"local"`
+		PrefixLen int    `json:"prefixlen"`
+	} `json:"addr_info"`
+}
+
+// parseIPJSON reads the output of ip -j addr or ip -j link, one record per
+// interface with its addresses as "address/prefix" separated by spaces
+func parseIPJSON(output string, args []string) (Parsed, error) {
+	if err := noArgs("ip-json", args); err != nil {
+		return Parsed{}, err
+	}
+	var interfaces []ipInterface
+	if err := json.Unmarshal([]byte(output), &interfaces); err != nil {
+		return Parsed{}, fmt.Errorf("ip-json: %w", err)
+	}
+
+	var records []Record
+	for _, iface := range interfaces {
+		// Some iproute2 versions print empty objects between interfaces
+		if iface.Name == "" {
+			continue
+		}
+		addresses := make([]string, 0, len(iface.AddrInfo))
+		for _, addr := range iface.AddrInfo {
+			if addr.Local != "" {
+				addresses = append(addresses, addr.Local+"/"+strconv.Itoa(addr.PrefixLen))
+			}
+		}
+		record := Record{
+			"name":      iface.Name,
+			"state":     iface.State,
+			"up":        slices.Contains(iface.Flags, "UP"),
+			"mtu":       iface.MTU,
+			"addresses": strings.Join(addresses, " "),
+		}
+		if iface.MAC != "" {
+			record["mac"] = iface.MAC
+		}
+		if iface.Master != "" {
+			record["master"] = iface.Master
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return Parsed{}, errors.New("ip-json: no interfaces (run ip with -j addr or -j link)")
+	}
+
+	return Parsed{Records: records, Columns: []string{"name", "state", "mac", "mtu", "addresses"}}, nil
+}
+
+// unitsListed matches the count systemctl prints after its legend
+var unitsListed = regexp.MustCompile(`^\d+ loaded units? listed`)
+
+// parseSystemctlUnits reads the output of systemctl list-units or
+// systemctl --failed, with or without the header and legend
+func parseSystemctlUnits(output string, args []string) (Parsed, error) {
+	if err := noArgs("systemctl-units", args); err != nil {
+		return Parsed{}, err
+	}
+
+	var records []Record
+	failed := 0
+	started := false
+	for n, line := range strings.Split(output, "\n") {
+		// Failed units are marked with a dot, or an asterisk without UTF-8
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "●*"))
+		if line == "" {
+			// The legend follows the units after a blank line
+			if started {
+				break
+			}
+			continue
+		}
+		if unitsListed.MatchString(line) || strings.HasPrefix(line, "Legend:") {
+			break
+		}
+		started = true
+
+		fields := strings.Fields(line)
+		if fields[0] == "UNIT" {
+			continue
+		}
+		if len(fields) < 4 {
+			return Parsed{}, fmt.Errorf("systemctl-units: line %d has %d columns, want at least 4", n+1, len(fields))
+		}
+		records = append(records, Record{
+			"unit":        fields[0],
+			"load":        fields[1],
+			"active":      fields[2],
+			"sub":         fields[3],
+			"description": strings.Join(fields[4:], " "),
+		})
+		if fields[2] == "failed" {
+			failed++
+		}
+	}
+
+	return Parsed{
+		Fields:  Record{"units": len(records), "failed": failed},
+		Records: records,
+		Columns: []string{"unit", "load", "active", "sub", "description"},
+	}, nil
+}
+
+// journalEntry matches a line of journalctl's short, short-precise or
+// short-iso output: time, host, identifier with an optional PID, message
+var journalEntry = regexp.MustCompile(`^(\w{3} [ \d]\d \d\d:\d\d:\d\d(?:\.\d+)?|\d{4}-\d\d-\d\dT\S+) (\S+) (\S+?)(?:\[(\d+)\])?: (.*)$`)
+
+// parseJournal reads journalctl output in one of the short formats, one
+// record per entry. Continuation lines are joined to their entry's message.
+func parseJournal(output string, args []string) (Parsed, error) {
+	if err := noArgs("journal", args); err != nil {
+		return Parsed{}, err
+	}
+
+	var records []Record
+	for n, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "", strings.HasPrefix(line, "-- "):
+			// Boot separators and "-- No entries --"
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			// Output cut by tail may start in the middle of an entry
+			if len(records) > 0 {
+				last := records[len(records)-1]
+				last["message"] = last["message"].(string) + "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		m := journalEntry.FindStringSubmatch(line)
+		if m == nil {
+			return Parsed{}, fmt.Errorf("journal: line %d is not a journal entry in a short format", n+1)
+		}
+		record := Record{
+			"time":       m[1],
+			"host":       m[2],
+			"identifier": m[3],
+			"message":    m[5],
+		}
+		if pid, err := strconv.Atoi(m[4]); err == nil {
+			record["pid"] = pid
+		}
+		records = append(records, record)
+	}
+
+	return Parsed{
+		Fields:  Record{"entries": len(records)},
+		Records: records,
+		Columns: []string{"time", "identifier", "message"},
+	}, nil
+}
+
+// parseKeyValue reads "key: value" lines into fields. An argument sets the
+// separator, e.g. `parser: key-value =` for sysctl-style output.
+func parseKeyValue(output string, args []string) (Parsed, error) {
+	sep := ":"
+	switch len(args) {
+	case 0:
+	case 1:
+		sep = args[0]
+	default:
+		return Parsed{}, fmt.Errorf("key-value: want one separator, got %q", strings.Join(args, " "))
+	}
+
+	values := parseKeyValues(output, sep)
+	delete(values, "")
+	if len(values) == 0 {
+		return Parsed{}, fmt.Errorf("key-value: no lines with %q", sep)
+	}
+	fields := make(Record, len(values))
+	for key, value := range values {
+		fields[key] = typedValue(value)
+	}
+	return Parsed{Fields: fields}, nil
+}
+
+// parseTable reads a whitespace-separated table with a header line, such as
+// the output of lsblk or ss. Keys are the lowercased headers, and the last
+// column takes the rest of each line.
+func parseTable(output string, args []string) (Parsed, error) {
+	if err := noArgs("table", args); err != nil {
+		return Parsed{}, err
+	}
+	lines := nonEmptyLines(output)
+	if len(lines) == 0 {
+		return Parsed{}, nil
+	}
+
+	header := strings.Fields(lines[0])
+	keys := make([]string, len(header))
+	for i, h := range header {
+		key := columnKey(h)
+		if key == "" || slices.Contains(keys[:i], key) {
+			key = "column_" + strconv.Itoa(i+1)
+		}
+		keys[i] = key
+	}
+
+	records := make([]Record, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		record := Record{}
+		for i, key := range keys {
+			if i >= len(fields) {
+				break
+			}
+			value := fields[i]
+			if i == len(keys)-1 {
+				value = strings.Join(fields[i:], " ")
+			}
+			record[key] = typedValue(value)
+		}
+		records = append(records, record)
+	}
+
+	return Parsed{Records: records, Columns: keys}, nil
+}
+
+// nonKeyChars matches runs of characters replaced in column keys
+var nonKeyChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// columnKey turns a table header such as "MOUNTPOINT" or "Use%" into a
+// record key such as "mountpoint" or "use_percent"
+func columnKey(header string) string {
+	key := strings.ReplaceAll(strings.ToLower(header), "%", "_percent")
+	return strings.Trim(nonKeyChars.ReplaceAllString(key, "_"), "_")
+}
+
+// nonEmptyLines splits output into lines, leaving out blank ones
+func nonEmptyLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// typedValue converts an integer such as "42" to int64, and leaves any
+// other text, including "007" or "6.10", as a string
+func typedValue(s string) any {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		return n
+	}
+	return s
+}
+
+// parseHumanSize parses a size as printed by df -h or lsblk, such as "20G"
+// or "476.9G", in powers of 1024
+func parseHumanSize(s string) (int64, bool) {
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	unit := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGTPE", s[n-1]); i >= 0 {
+			unit = int64(1) << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(v * float64(unit)), true
+}
+
+// objectKeys returns the keys of a JSON object in the order they appear
+func objectKeys(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, errors.New("expected a JSON object")
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// jsonScalar decodes a JSON value for a record: whole numbers become int64
+// and lists of strings, such as lsblk's mountpoints, are joined with spaces.
+// Nulls, empty lists and objects are left out.
+func jsonScalar(raw json.RawMessage) (any, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case string, bool:
+		return v, true
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, true
+		}
+		f, err := v.Float64()
+		return f, err == nil
+	case []any:
+		var items []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, " "), len(items) > 0
+	}
+	return nil, false
+}
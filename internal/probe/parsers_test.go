@@ -0,0 +1,172 @@
+package probe
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// parserCases pair sample command output with records expected from it,
+// compared as JSON
+var parserCases = []struct {
+	parser string
+	output string
+	fields string
+	record string // first record
+	count  int    // number of records
+}{
+	{
+		parser: "df",
+		output: "Filesystem     Type   Size  Used Avail Use% Mounted on\n" +
+			"/dev/nvme0n1p2 btrfs  476G  201G  273G  43% /\n" +
+			"/dev/mapper/a-very-long-volume-name\n" +
+			"               ext4   20G   19G  1.0G  95% /mnt/My Data\n",
+		record: `{"avail":"273G","avail_bytes":293131517952,"filesystem":"/dev/nvme0n1p2","mount":"/","size":"476G","size_bytes":511101108224,"type":"btrfs","use_percent":43,"used":"201G","used_bytes":215822106624}`,
+		count:  2,
+	},
+	{
+		parser: "df",
+		output: "Filesystem     1K-blocks  Used Available Use% Mounted on\ntmpfs             8192000  1024   8190976   1% /tmp\n",
+		record: `{"avail":"8190976","avail_bytes":8387559424,"filesystem":"tmpfs","mount":"/tmp","size":"8192000","size_bytes":8388608000,"use_percent":1,"used":"1024","used_bytes":1048576}`,
+		count:  1,
+	},
+	{
+		parser: "lsblk-json",
+		output: `{"blockdevices": [{"name": "nvme0n1", "size": 512110190592, "type": "disk", "mountpoints": [null],
+			"children": [{"name": "nvme0n1p1", "size": 1073741824, "type": "part", "mountpoints": ["/boot"]}]}]}`,
+		record: `{"name":"nvme0n1","size":512110190592,"type":"disk"}`,
+		count:  2,
+	},
+	{
+		parser: "ip-json",
+		output: `[{"ifindex": 1, "ifname": "lo", "flags": ["LOOPBACK","UP","LOWER_UP"], "mtu": 65536, "operstate": "UNKNOWN",
+			"address": "00:00:00:00:00:00", "addr_info": [{"family": "inet", "local": "127.0.0.1", "prefixlen": 8}, {"family": "inet6", "local": "::1", "prefixlen": 128}]},
+			{}, {"ifindex": 2, "ifname": "wlan0", "flags": ["BROADCAST"], "mtu": 1500, "operstate": "DOWN", "address": "aa:bb:cc:dd:ee:ff", "addr_info": []}]`,
+		record: `{"addresses":"127.0.0.1/8 ::1/128","mac":"00:00:00:00:00:00","mtu":65536,"name":"lo","state":"UNKNOWN","up":true}`,
+		count:  2,
+	},
+	{
+		parser: "systemctl-units",
+		output: "  UNIT                 LOAD   ACTIVE SUB    DESCRIPTION\n" +
+			"● foo.service          loaded failed failed Foo daemon\n" +
+			"  bar.service          loaded active running Bar | baz\n\n" +
+			"Legend: LOAD   → Reflects whether the unit definition was properly loaded.\n\n2 loaded units listed.\n",
+		fields: `{"failed":1,"units":2}`,
+		record: `{"active":"failed","description":"Foo daemon","load":"loaded","sub":"failed","unit":"foo.service"}`,
+		count:  2,
+	},
+	{
+		parser: "systemctl-units",
+		output: "0 loaded units listed.\n",
+		fields: `{"failed":0,"units":0}`,
+	},
+	{
+		parser: "journal",
+		output: "-- Boot 0123 --\n" +
+			"Jun 14 08:00:00 archbox systemd[1]: Failed to start Foo.\n" +
+			"    with details\n" +
+			"2024-06-14T08:00:01+0200 archbox kernel: usb 1-2: device descriptor read/64, error -71\n",
+		fields: `{"entries":2}`,
+		record: `{"host":"archbox","identifier":"systemd","message":"Failed to start Foo.\nwith details","pid":1,"time":"Jun 14 08:00:00"}`,
+		count:  2,
+	},
+	{
+		parser: "key-value",
+		output: "Name: archbox\nUptime: 3600\nVersion: 6.10\n",
+		fields: `{"Name":"archbox","Uptime":3600,"Version":"6.10"}`,
+	},
+	{
+		parser: "key-value =",
+		output: "vm.swappiness = 60\nnet.ipv4.ip_forward = 0\n",
+		fields: `{"net.ipv4.ip_forward":0,"vm.swappiness":60}`,
+	},
+	{
+		parser: "table",
+		output: "NAME   SIZE TYPE MOUNTPOINT\nsda     20G disk\nsda1    20G part /mnt/My Data\n",
+		record: `{"name":"sda","size":"20G","type":"disk"}`,
+		count:  2,
+	},
+}
+
+// TestParsers checks each parser against sample output
+func TestParsers(t *testing.T) {
+	for _, c := range parserCases {
+		name, args := parseCollector(c.parser)
+		parser, ok := LookupParser(name)
+		if !ok {
+			t.Fatalf("%s: not registered", name)
+		}
+		parsed, err := parser.Parse(c.output, args)
+		if err != nil {
+			t.Errorf("%s: %v", c.parser, err)
+			continue
+		}
+		if c.fields != "" {
+			if got := jsonString(t, parsed.Fields); got != c.fields {
+				t.Errorf("%s: fields\n  %s\nwant\n  %s", c.parser, got, c.fields)
+			}
+		}
+		if len(parsed.Records) != c.count {
+			t.Errorf("%s: %d records, want %d: %s", c.parser, len(parsed.Records), c.count, jsonString(t, parsed.Records))
+			continue
+		}
+		if c.count > 0 {
+			if got := jsonString(t, parsed.Records[0]); got != c.record {
+				t.Errorf("%s: first record\n  %s\nwant\n  %s", c.parser, got, c.record)
+			}
+			if len(parsed.Columns) == 0 {
+				t.Errorf("%s: records without columns", c.parser)
+			}
+		}
+	}
+}
+
+// TestParserErrors checks that output in the wrong format is reported
+// rather than parsed into nonsense
+func TestParserErrors(t *testing.T) {
+	cases := []struct{ parser, output string }{
+		{"df", "NAME SIZE\nsda 20G\n"},
+		{"lsblk-json", "NAME SIZE\nsda 20G\n"},
+		{"ip-json", `{"blockdevices": []}`},
+		{"systemctl-units", "foo.service loaded\n"},
+		{"journal", "not a journal line\n"},
+		{"key-value", "no separator here\n"},
+	}
+	for _, c := range cases {
+		parser, _ := LookupParser(c.parser)
+		if parsed, err := parser.Parse(c.output, nil); err == nil {
+			t.Errorf("%s: parsed %q without error: %s", c.parser, c.output, jsonString(t, parsed))
+		}
+	}
+}
+
+// TestRunnerParser checks that the runner parses successful output within
+// max_lines and keeps the output when the parser fails
+func TestRunnerParser(t *testing.T) {
+	runner := NewRunner(platform.Platform{})
+
+	result := runner.Run(context.Background(), Task{
+		Name:     "Table",
+		Command:  "printf 'NAME SIZE\\nsda 20G\\nsdb 1T\\nsdc 2T\\n'",
+		Parser:   "table",
+		MaxLines: 3,
+	})
+	if result.Status != StatusSuccess || len(result.Records) != 2 || result.ParseError != "" {
+		t.Errorf("table: %s, %d records (%s), want 2 within max_lines", result.Status, len(result.Records), result.ParseError)
+	}
+
+	result = runner.Run(context.Background(), Task{Name: "Not JSON", Command: "echo hello", Parser: "ip-json"})
+	if result.Status != StatusSuccess || result.Output != "hello" || result.Records != nil ||
+		!strings.HasPrefix(result.ParseError, "ip-json: ") {
+		t.Errorf("ip-json on text: %s %q, records %v, parse error %q", result.Status, result.Output, result.Records, result.ParseError)
+	}
+
+	if err := (Task{Name: "Both", Collector: "meminfo", Parser: "df"}).validate(); err == nil {
+		t.Error("parser with a collector: no error")
+	}
+	if err := (Task{Name: "Unknown", Command: "true", Parser: "nope"}).validate(); err == nil {
+		t.Error("unknown parser: no error")
+	}
+}
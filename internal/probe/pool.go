@@ -0,0 +1,195 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultWorkers is the number of tasks run concurrently by default
+const DefaultWorkers = 4
+
+// Pool runs tasks concurrently on a fixed number of workers
+type Pool struct {
+	Runner  *Runner
+	Workers int
+
+	// OnStart and OnDone, if set, are called from the worker goroutines.
+	// OnDone is also given the index of the task in the tasks run.
+	OnStart func(task Task)
+	OnDone  func(i int, result TaskResult)
+}
+
+// NewPool creates a worker pool around a runner
+func NewPool(r *Runner, workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{
+		Runner:  r,
+		Workers: workers,
+	}
+}
+
+// Run executes all tasks and returns their results in task order. A task
+// starts once the tasks it depends on have finished; if one of them did not
+// succeed, the task is skipped. Once ctx is done, the remaining tasks are
+// returned as cancelled.
+func (p *Pool) Run(ctx context.Context, tasks []Task) []TaskResult {
+	results := make([]TaskResult, len(tasks))
+	if len(tasks) == 0 {
+		return results
+	}
+
+	// Count the unfinished dependencies of each task
+	byID := make(map[string]int)
+	for i, t := range tasks {
+		if t.ID != "" {
+			byID[t.ID] = i
+		}
+	}
+	waiting := make([]int, len(tasks))
+	dependents := make([][]int, len(tasks))
+	for i, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if d, ok := byID[dep]; ok {
+				waiting[i]++
+				dependents[d] = append(dependents[d], i)
+			}
+		}
+	}
+
+	// Create work queue, starting with the tasks that depend on nothing
+	taskChan := make(chan int, len(tasks))
+	for i := range tasks {
+		if waiting[i] == 0 {
+			taskChan <- i
+		}
+	}
+
+	var mu sync.Mutex
+	facts := make(Facts)
+	finished := 0
+	for i, cyclic := range inCycle(waiting, dependents) {
+		if cyclic {
+			results[i] = p.skip(tasks[i], "Dependency cycle")
+			finished++
+			if p.OnDone != nil {
+				p.OnDone(i, results[i])
+			}
+		}
+	}
+	if finished == len(tasks) {
+		close(taskChan)
+	}
+
+	// Spawn workers
+	var wg sync.WaitGroup
+	for i := 0; i < p.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range taskChan {
+				mu.Lock()
+				task, failed := prepareTask(tasks[idx], facts, results, byID)
+				mu.Unlock()
+
+				var result TaskResult
+				if failed != "" && ctx.Err() == nil {
+					result = p.skip(task, "Dependency "+failed)
+				} else {
+					if p.OnStart != nil {
+						p.OnStart(task)
+					}
+					result = p.Runner.Run(ctx, task)
+				}
+
+				// Record the result and queue the tasks it unblocks
+				mu.Lock()
+				results[idx] = result
+				if task.ID != "" && result.Status == StatusSuccess {
+					facts[task.ID] = task.exportValues(result.Output)
+				}
+				for _, d := range dependents[idx] {
+					waiting[d]--
+					if waiting[d] == 0 {
+						taskChan <- d
+					}
+				}
+				finished++
+				if finished == len(tasks) {
+					close(taskChan)
+				}
+				mu.Unlock()
+
+				if p.OnDone != nil {
+					p.OnDone(idx, result)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// skip returns the result of a task the pool does not start, recording it
+// so that a replay of the run includes the task
+func (p *Pool) skip(task Task, reason string) TaskResult {
+	if p.Runner.Recorder != nil {
+		p.Runner.Recorder.skipped(task, reason)
+	}
+	return skippedResult(task, reason)
+}
+
+// prepareTask fills in the exported values of a task's dependencies. If a
+// dependency did not succeed, it also returns a description of it.
+func prepareTask(task Task, facts Facts, results []TaskResult, byID map[string]int) (Task, string) {
+	for _, dep := range task.DependsOn {
+		d, ok := byID[dep]
+		if !ok {
+			return task, dep + " is not selected"
+		}
+		if status := results[d].Status; status != StatusSuccess {
+			return task, fmt.Sprintf("%q %s", results[d].Name, strings.ToLower(status.String()))
+		}
+	}
+	return task.withFacts(facts), ""
+}
+
+// skippedResult returns the result of a task that was not run
+func skippedResult(task Task, reason string) TaskResult {
+	result := newResult(task)
+	result.Status = StatusSkipped
+	result.SkipReason = reason
+	return result
+}
+
+// inCycle marks the tasks that can never start because their dependencies
+// form a cycle. The loader rejects such manifests, but a caller may not.
+func inCycle(waiting []int, dependents [][]int) []bool {
+	left := append([]int(nil), waiting...)
+	var queue []int
+	for i, n := range left {
+		if n == 0 {
+			queue = append(queue, i)
+		}
+	}
+	reached := make([]bool, len(left))
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		reached[i] = true
+		for _, d := range dependents[i] {
+			left[d]--
+			if left[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	for i := range reached {
+		reached[i] = !reached[i]
+	}
+	return reached
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package probe
+
+import (
+	"os"
+	"os/exec"
+)
+
+// exitSignal returns "" as processes are not terminated by signals here
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
+
+// setProcessGroup leaves cmd as is; only the shell is killed on cancellation
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -3,8 +3,12 @@ package probe
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,12 +19,30 @@ const (
 	DefaultTimeout  = 30 * time.Second
 	DefaultMaxLines = 500
 	DefaultMaxBytes = 64 * 1024 // 64KB
+
+	// outputWaitDelay bounds how long a killed command's output is drained
+	outputWaitDelay = 2 * time.Second
 )
 
 // Runner executes diagnostic tasks
 type Runner struct {
 	Platform platform.Platform
 	Timeout  time.Duration
+	Root     fs.FS // filesystem read by collectors
+
+	// Escalator, if set, runs `privilege: sudo` tasks as root when the
+	// runner itself is not root
+	Escalator *Escalator
+
+	// Recorder, if set, keeps the output of every command for a fixture
+	Recorder *Recorder
+	// KeepBytes is how much of each output stream is kept while a command
+	// runs, if more than the task's max_bytes, so that the recorder sees
+	// output the report leaves out
+	KeepBytes int
+	// Replay, if set, takes the outcome of every task from a fixture
+	// instead of running it
+	Replay *Fixture
 }
 
 // NewRunner creates a new task runner
@@ -28,13 +50,23 @@ func NewRunner(p platform.Platform) *Runner {
 	return &Runner{
 		Platform: p,
 		Timeout:  DefaultTimeout,
+		Root:     HostRoot(),
 	}
 }
 
 // CanRun checks if a task can be executed on the current system
 func (r *Runner) CanRun(task Task) (bool, string) {
+	// A replayed task runs if it ran when it was recorded
+	if r.Replay != nil {
+		rec, ok := r.Replay.Lookup(task.Name)
+		if !ok {
+			return false, "Not recorded in fixture"
+		}
+		return rec.SkipReason == "", rec.SkipReason
+	}
+
 	// Check privilege requirements
-	if task.Privilege == "sudo" && !r.Platform.IsRoot {
+	if task.Privilege == "sudo" && !r.Platform.IsRoot && r.Escalator == nil {
 		return false, "Requires sudo privileges"
 	}
 
@@ -50,62 +82,370 @@ func (r *Runner) CanRun(task Task) (bool, string) {
 		return false, "Environment mismatch: requires " + strings.Join(task.Tags, " or ")
 	}
 
+	// Check the task's condition
+	if task.When != "" {
+		return r.checkCondition(task.When)
+	}
+
 	return true, ""
 }
 
-// Run executes a single task and returns the result
-func (r *Runner) Run(task Task) TaskResult {
-	result := TaskResult{
-		Name:     task.Name,
-		Command:  task.Command,
-		Category: task.Category,
-		Status:   StatusPending,
+// checkCondition evaluates a `when:` expression
+func (r *Runner) checkCondition(when string) (bool, string) {
+	cond, err := parseCondition(when)
+	if err != nil {
+		return false, "Invalid condition: " + err.Error()
+	}
+	ok, reason, err := cond.Eval(conditionEnv{platform: r.Platform, root: r.Root})
+	if err != nil {
+		return false, "Invalid condition: " + err.Error()
 	}
+	if !ok {
+		return false, "Condition not met: " + reason
+	}
+	return true, ""
+}
+
+// ErrDeadline is the cancellation cause used when a run exceeds its deadline
+var ErrDeadline = errors.New("run deadline reached")
+
+// Run executes a single task and returns the result. Tasks are cancelled
+// if ctx is done before they start or while they run.
+func (r *Runner) Run(ctx context.Context, task Task) TaskResult {
+	result := newResult(task)
 
 	// Check if we can run this task
 	canRun, reason := r.CanRun(task)
 	if !canRun {
+		if r.Recorder != nil {
+			r.Recorder.skipped(task, reason)
+		}
 		result.Status = StatusSkipped
 		result.SkipReason = reason
 		return result
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
-	defer cancel()
+	if ctx.Err() != nil {
+		result.Status = StatusCancelled
+		result.Error = "Not started: " + cancelCause(ctx)
+		return result
+	}
 
-	// Prepare command
-	cmd := exec.CommandContext(ctx, "sh", "-c", task.Command)
+	if r.Replay != nil {
+		return r.replay(ctx, task, result)
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	if task.Privilege == "sudo" && !r.Platform.IsRoot {
+		if task.Timeout <= 0 {
+			task.Timeout = r.Timeout
+		}
+		result = r.Escalator.Run(ctx, task)
+		if r.Recorder != nil {
+			r.Recorder.escalated(task, result)
+		}
+		return result
+	}
 
-	// Execute
-	start := time.Now()
-	err := cmd.Run()
-	result.Duration = time.Since(start)
+	result = r.execute(ctx, task, result)
+	if r.Recorder != nil && result.Status == StatusCancelled {
+		r.Recorder.cancelled(task)
+	}
+	return result
+}
+
+// replay returns the recorded outcome of a task. Recorded command output
+// goes through the same checks as live output, so changes to a task's
+// ok_exit_codes, empty_is or limits show up in the replayed report.
+func (r *Runner) replay(ctx context.Context, task Task, result TaskResult) TaskResult {
+	rec, _ := r.Replay.Lookup(task.Name)
+	result.Escalated = rec.Escalated
+	if rec.Cancelled {
+		result.Status = StatusCancelled
+		result.Error = "Stopped: recorded run was interrupted"
+		return result
+	}
+	return r.execute(ctx, task, result)
+}
+
+// execute runs a task that has passed its checks, retrying failed commands
+func (r *Runner) execute(ctx context.Context, task Task, result TaskResult) TaskResult {
+	if task.Collector != "" {
+		return r.collect(task, result)
+	}
+	if r.Replay != nil {
+		if rec, _ := r.Replay.Lookup(task.Name); len(rec.Attempts) == 0 {
+			result.Status = StatusFailed
+			result.Error = "No command output recorded in fixture"
+			return result
+		}
+	}
+
+	backoff := task.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		result = r.runCommand(ctx, task, result)
+		result.Attempts = attempt
+
+		retry := result.Status == StatusFailed || result.Status == StatusTimedOut
+		if !retry || attempt > task.Retries {
+			return result
+		}
+
+		// Wait before the next attempt unless the run ends first; a replay
+		// has nothing to wait for
+		if backoff > 0 && r.Replay == nil {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return result
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// newResult returns a pending result for a task
+func newResult(task Task) TaskResult {
+	result := TaskResult{
+		Name:     task.Name,
+		Command:  task.Command,
+		Category: task.Category,
+		Status:   StatusPending,
+		ExitCode: -1,
+		Priority: task.Priority,
+	}
+	if task.Collector != "" {
+		result.Command = "collector: " + task.Collector
+	}
+	return result
+}
+
+// runCommand runs one attempt of a command task, or replays it
+func (r *Runner) runCommand(ctx context.Context, task Task, result TaskResult) TaskResult {
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = r.Timeout
+	}
+
+	var attempt CommandRecord
+	if r.Replay != nil {
+		rec, _ := r.Replay.Lookup(task.Name)
+		attempt, _ = rec.attempt(result.Attempts)
+	} else {
+		attempt = r.execCommand(ctx, task, timeout)
+		if r.Recorder != nil && ctx.Err() == nil {
+			r.Recorder.command(task, attempt)
+		}
+	}
+
+	result.Duration += attempt.duration()
+	result.ExitCode = attempt.ExitCode
+	result.Signal = attempt.Signal
 
 	// Get output
-	result.Output = truncateOutput(stdout.String(), task.MaxLines, task.MaxBytes)
-	result.Error = truncateOutput(stderr.String(), task.MaxLines, task.MaxBytes)
+	result.StdoutSize = attempt.StdoutBytes
+	result.StderrSize = attempt.StderrBytes
+	result.Output = truncateOutput(attempt.Stdout, task.MaxLines, task.MaxBytes)
+	result.Error = truncateOutput(attempt.Stderr, task.MaxLines, task.MaxBytes)
 
 	// Determine status
-	if ctx.Err() == context.DeadlineExceeded {
+	switch {
+	case ctx.Err() != nil:
+		result.Status = StatusCancelled
+		result.Error = "Stopped: " + cancelCause(ctx)
+	case attempt.TimedOut:
+		result.Status = StatusTimedOut
+		result.Error = "Command timed out after " + timeout.String()
+	case attempt.Error != "":
 		result.Status = StatusFailed
-		result.Error = "Command timed out after " + r.Timeout.String()
-	} else if err != nil {
+		if result.Error == "" {
+			result.Error = attempt.Error
+		}
+	case attempt.Signal != "":
 		result.Status = StatusFailed
 		if result.Error == "" {
-			result.Error = err.Error()
+			result.Error = "killed by " + attempt.Signal
 		}
-	} else {
+	case !task.exitCodeOK(result.ExitCode):
+		// A non-zero exit code may be expected, e.g. 3 from systemctl
+		// is-active, and 0 may be unexpected if ok_exit_codes omits it
+		result.Status = StatusFailed
+		if result.Error == "" {
+			result.Error = fmt.Sprintf("exit status %d", result.ExitCode)
+		}
+	case strings.TrimSpace(result.Output) == "":
+		result.Status = emptyStatus(task)
+		if result.Status == StatusSkipped {
+			result.SkipReason = "No output"
+		} else if result.Status == StatusFailed && result.Error == "" {
+			result.Error = "No output"
+		}
+	default:
 		result.Status = StatusSuccess
 	}
 
+	if task.Parser != "" && result.Status == StatusSuccess {
+		result = parseOutput(task, attempt.Stdout, result)
+	}
 	return result
 }
 
+// execCommand runs a task's command once and returns its outcome
+func (r *Runner) execCommand(ctx context.Context, task Task, timeout time.Duration) CommandRecord {
+	// Create context with timeout
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Prepare command
+	cmd := exec.CommandContext(attemptCtx, "sh", "-c", task.Command)
+	setProcessGroup(cmd)
+	if len(task.env) > 0 {
+		cmd.Env = append(os.Environ(), task.env...)
+	}
+	// Children that left the process group may hold the output pipes open
+	cmd.WaitDelay = outputWaitDelay
+
+	// Output beyond max_bytes, or KeepBytes, is counted but not kept
+	keep := task.MaxBytes
+	if keep <= 0 {
+		keep = DefaultMaxBytes
+	}
+	keep = max(keep, r.KeepBytes)
+	stdout := newCappedBuffer(keep)
+	stderr := newCappedBuffer(keep)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Execute
+	start := time.Now()
+	err := startCommand(cmd, task)
+	if err == nil {
+		err = cmd.Wait()
+	}
+	attempt := CommandRecord{
+		Stdout:      stdout.String(),
+		Stderr:      stderr.String(),
+		StdoutBytes: stdout.total,
+		StderrBytes: stderr.total,
+		ExitCode:    -1,
+		TimedOut:    attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil,
+		DurationMS:  float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if cmd.ProcessState != nil {
+		attempt.ExitCode = cmd.ProcessState.ExitCode()
+		attempt.Signal = exitSignal(cmd.ProcessState)
+	}
+
+	// An exit status is judged by runCommand; anything else means the
+	// command could not be run or its output could not be read
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+// emptyStatus returns the status of a successful command that printed nothing
+func emptyStatus(task Task) Status {
+	switch task.EmptyIs {
+	case EmptyIsSkipped:
+		return StatusSkipped
+	case EmptyIsFailed:
+		return StatusFailed
+	default:
+		return StatusSuccess
+	}
+}
+
+// cancelCause describes why ctx was cancelled
+func cancelCause(ctx context.Context) string {
+	cause := context.Cause(ctx)
+	if cause == nil || errors.Is(cause, context.Canceled) {
+		return "run interrupted"
+	}
+	return cause.Error()
+}
+
+// collect runs the task's collector in place of a command
+func (r *Runner) collect(task Task, result TaskResult) TaskResult {
+	name, args := parseCollector(task.Collector)
+	collector, ok := LookupCollector(name)
+	if !ok {
+		result.Status = StatusFailed
+		result.Error = "Unknown collector: " + name
+		return result
+	}
+
+	var collection Collection
+	var err error
+	if r.Replay != nil {
+		collection, err = r.replayCollection(task)
+	} else {
+		start := time.Now()
+		collection, err = collector.Collect(r.Root, args)
+		result.Duration = time.Since(start)
+		if r.Recorder != nil {
+			r.Recorder.collected(task, collection, err)
+		}
+	}
+
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = StatusSuccess
+	result.ExitCode = 0
+	result.Output = truncateOutput(collection.Text, task.MaxLines, task.MaxBytes)
+	result.Fields = collection.Fields
+	result.Records = collection.Records
+	return result
+}
+
+// replayCollection returns the recorded output of a collector task
+func (r *Runner) replayCollection(task Task) (Collection, error) {
+	rec, _ := r.Replay.Lookup(task.Name)
+	if rec.Error != "" {
+		return Collection{}, errors.New(rec.Error)
+	}
+	if rec.Collection == nil {
+		return Collection{}, errors.New("no collector output recorded in fixture")
+	}
+	return *rec.Collection, nil
+}
+
+// cappedBuffer keeps the first bytes written to it and counts the rest, so
+// a command's output is bounded while it runs rather than after it exits
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	total int
+}
+
+// newCappedBuffer keeps one byte more than maxBytes, so that truncateOutput
+// can tell that the output was cut
+func newCappedBuffer(maxBytes int) *cappedBuffer {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &cappedBuffer{limit: maxBytes + 1}
+}
+
+// Write always accepts all of p, so the command is never blocked or failed
+// by a full buffer
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	c.total += len(p)
+	if room := c.limit - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// String returns the kept output
+func (c *cappedBuffer) String() string {
+	return c.buf.String()
+}
+
 // truncateOutput limits output by lines and bytes
 func truncateOutput(output string, maxLines, maxBytes int) string {
 	if maxLines <= 0 {
@@ -123,7 +463,7 @@ func truncateOutput(output string, maxLines, maxBytes int) string {
 	// Truncate by lines
 	lines := strings.Split(output, "\n")
 	if len(lines) > maxLines {
-		output = strings.Join(lines[:maxLines], "\n") + "\n... [truncated: exceeded " + string(rune(maxLines+'0')) + " lines]"
+		output = strings.Join(lines[:maxLines], "\n") + "\n... [truncated: exceeded " + strconv.Itoa(maxLines) + " lines]"
 	}
 
 	return strings.TrimSpace(output)
@@ -133,14 +473,14 @@ func truncateOutput(output string, maxLines, maxBytes int) string {
 func formatBytes(b int) string {
 	const unit = 1024
 	if b < unit {
-		return string(rune(b+'0')) + "B"
+		return strconv.Itoa(b) + "B"
 	}
 	div, exp := unit, 0
 	for n := b / unit; n >= unit; n /= unit {
 		div *= unit
 		exp++
 	}
-	return string(rune(b/div+'0')) + string("KMGTPE"[exp]) + "B"
+	return strconv.Itoa(b/div) + string("KMGTPE"[exp]) + "B"
 }
 
 // CheckBinary verifies if a binary exists in PATH
@@ -0,0 +1,34 @@
+package probe
+
+import "testing"
+
+// TestFormatBytes checks byte counts of more than one digit per unit
+func TestFormatBytes(t *testing.T) {
+	tests := map[int]string{
+		7:         "7B",
+		512:       "512B",
+		1024:      "1KB",
+		64 << 10:  "64KB",
+		900 << 20: "900MB",
+		16 << 30:  "16GB",
+	}
+	for b, want := range tests {
+		if got := formatBytes(b); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", b, got, want)
+		}
+	}
+}
+
+// TestValidateNice checks the range of nice, where 0 leaves it unset
+func TestValidateNice(t *testing.T) {
+	tests := map[int]bool{0: true, 1: true, 19: true, -1: false, 20: false}
+	for nice, valid := range tests {
+		err := Task{Name: "Scan", Command: "true", Nice: nice}.validate()
+		if (err == nil) != valid {
+			t.Errorf("nice %d: error %v", nice, err)
+		}
+		if err != nil && err.Error() != `task "Scan": nice must be between 1 and 19` {
+			t.Errorf("nice %d: %v", nice, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package probe
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Selector picks a subset of tasks. Empty fields select everything.
+// Name patterns are case-insensitive globs (`*`, `?`), or regular
+// expressions when wrapped in slashes, e.g. `/^pipewire/`.
+type Selector struct {
+	Categories []string // task categories, e.g. "network"
+	Names      []string // patterns matched against Task.Name
+	Exclude    []string // patterns matched against Task.Name, applied last
+	Tags       []string // tasks carrying any of these tags
+}
+
+// IsEmpty reports whether the selector selects every task
+func (s Selector) IsEmpty() bool {
+	return len(s.Categories) == 0 && len(s.Names) == 0 && len(s.Exclude) == 0 && len(s.Tags) == 0
+}
+
+// Filter returns the selected tasks and the tasks they depend on,
+// preserving their order
+func (s Selector) Filter(tasks []Task) ([]Task, error) {
+	if s.IsEmpty() {
+		return tasks, nil
+	}
+
+	include, err := compilePatterns(s.Names)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(s.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []Task
+	for _, task := range tasks {
+		if len(s.Categories) > 0 && !containsFold(s.Categories, task.Category) {
+			continue
+		}
+		if len(include) > 0 && !matchAny(include, task.Name) {
+			continue
+		}
+		if len(s.Tags) > 0 && !anyContainsFold(s.Tags, task.Tags) {
+			continue
+		}
+		if matchAny(exclude, task.Name) {
+			continue
+		}
+		selected = append(selected, task)
+	}
+
+	return WithDependencies(tasks, selected), nil
+}
+
+// compilePatterns turns glob or /regex/ patterns into regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		var expr string
+		if len(p) >= 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr = p[1 : len(p)-1]
+		} else {
+			expr = "^" + globToRegexp(p) + "$"
+		}
+
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid task pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// globToRegexp converts a shell-style glob to a regular expression. Unlike
+// path.Match, `*` also matches `/`, which appears in task names.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// matchAny reports whether name matches any of the patterns
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyContainsFold reports whether any of values is in list, ignoring case
+func anyContainsFold(list, values []string) bool {
+	for _, v := range values {
+		if containsFold(list, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,13 @@
 package probe
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
 
 // Status represents the execution status of a task
 type Status int
@@ -11,6 +18,8 @@ const (
 	StatusSuccess
 	StatusSkipped
 	StatusFailed
+	StatusTimedOut  // the task exceeded its own timeout
+	StatusCancelled // the run was interrupted or hit its deadline
 )
 
 // String returns the string representation of a Status
@@ -26,29 +35,243 @@ func (s Status) String() string {
 		return "Skipped"
 	case StatusFailed:
 		return "Failed"
+	case StatusTimedOut:
+		return "Timed Out"
+	case StatusCancelled:
+		return "Cancelled"
 	default:
 		return "Unknown"
 	}
 }
 
+// IsProblem reports whether the task ran, or should have run, without
+// producing a result
+func (s Status) IsProblem() bool {
+	return s == StatusFailed || s == StatusTimedOut || s == StatusCancelled
+}
+
+// MarshalText encodes a Status as its lowercase name, e.g. "timed_out"
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(strings.ReplaceAll(strings.ToLower(s.String()), " ", "_")), nil
+}
+
+// UnmarshalText decodes a Status from its name
+func (s *Status) UnmarshalText(text []byte) error {
+	for candidate := StatusPending; candidate <= StatusCancelled; candidate++ {
+		if name, _ := candidate.MarshalText(); strings.EqualFold(string(name), string(text)) {
+			*s = candidate
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
 // Task represents a single diagnostic command to execute
 type Task struct {
 	Name      string   `yaml:"name"`
 	Command   string   `yaml:"command"`
+	Collector string   `yaml:"collector,omitempty"` // built-in collector used instead of command, e.g. "meminfo"
+	Parser    string   `yaml:"parser,omitempty"`    // turns the command's output into structured fields, e.g. "df"
 	Privilege string   `yaml:"privilege,omitempty"` // "sudo" or empty
 	MaxLines  int      `yaml:"max_lines,omitempty"`
 	MaxBytes  int      `yaml:"max_bytes,omitempty"`
 	Requires  []string `yaml:"requires,omitempty"` // binary dependencies
 	Tags      []string `yaml:"tags,omitempty"`     // e.g., ["hyprland", "wayland"]
+	When      string   `yaml:"when,omitempty"`     // condition such as `file_exists("/sys/class/power_supply/BAT0")`
 	Category  string   `yaml:"category,omitempty"` // for grouping in report
+	Disabled  bool     `yaml:"disabled,omitempty"` // removes a task of the same name from an earlier source
+	Priority  int      `yaml:"priority,omitempty"` // higher is kept first under a token budget; default 0
+
+	ID        string            `yaml:"id,omitempty"`         // referenced by depends_on and {{id.name}} placeholders
+	DependsOn []string          `yaml:"depends_on,omitempty"` // IDs of tasks that must succeed before this one runs
+	Exports   map[string]string `yaml:"exports,omitempty"`    // values for dependent tasks: name to a regular expression matched against each output line
+
+	Timeout      time.Duration `yaml:"timeout,omitempty"`       // per attempt; defaults to Runner.Timeout
+	Retries      int           `yaml:"retries,omitempty"`       // extra attempts after a failure or timeout
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty"` // wait before the first retry, doubled for each further one
+
+	OkExitCodes []int  `yaml:"ok_exit_codes,omitempty"` // exit codes that count as success; default [0]
+	EmptyIs     string `yaml:"empty_is,omitempty"`      // status when a successful command prints nothing: success, skipped or failed
+
+	Nice      int      `yaml:"nice,omitempty"`       // CPU priority adjustment, 1 (slightly lower) to 19 (lowest)
+	IONice    string   `yaml:"ionice,omitempty"`     // I/O class: "idle", or "best-effort" with an optional level such as "best-effort:7"
+	MaxMemory ByteSize `yaml:"max_memory,omitempty"` // address space limit for the command and its children, e.g. "512M"
+
+	Redact []RedactRule `yaml:"redact,omitempty"` // task-specific values to mask in reports
+
+	env []string // exported values of dependencies, set by the pool
+}
+
+// Values of Task.EmptyIs
+const (
+	EmptyIsSuccess = "success"
+	EmptyIsSkipped = "skipped"
+	EmptyIsFailed  = "failed"
+)
+
+// validate checks the fields of a task that the YAML decoder cannot
+func (t Task) validate() error {
+	if err := checkCollector(t); err != nil {
+		return err
+	}
+	if err := checkParser(t); err != nil {
+		return err
+	}
+	if err := checkExports(t); err != nil {
+		return err
+	}
+	if t.When != "" {
+		if _, err := parseCondition(t.When); err != nil {
+			return fmt.Errorf("task %q: %w", t.Name, err)
+		}
+	}
+	switch t.EmptyIs {
+	case "", EmptyIsSuccess, EmptyIsSkipped, EmptyIsFailed:
+	default:
+		return fmt.Errorf("task %q: invalid empty_is %q (want success, skipped or failed)", t.Name, t.EmptyIs)
+	}
+	if t.Nice < 0 || t.Nice > 19 {
+		return fmt.Errorf("task %q: nice must be between 1 and 19", t.Name)
+	}
+	if _, _, err := parseIONice(t.IONice); err != nil {
+		return fmt.Errorf("task %q: %w", t.Name, err)
+	}
+	return nil
+}
+
+// Values of the class in Task.IONice
+const (
+	IONiceBestEffort = "best-effort"
+	IONiceIdle       = "idle"
+)
+
+// parseIONice splits an ionice value into its class and level. The level
+// defaults to 4, the kernel's default for best-effort.
+func parseIONice(value string) (string, int, error) {
+	if value == "" {
+		return "", 0, nil
+	}
+	class, levelText, hasLevel := strings.Cut(value, ":")
+	level := 4
+	switch class {
+	case IONiceIdle:
+		if hasLevel {
+			return "", 0, fmt.Errorf("ionice %q: the idle class has no level", value)
+		}
+	case IONiceBestEffort:
+		if hasLevel {
+			n, err := strconv.Atoi(levelText)
+			if err != nil || n < 0 || n > 7 {
+				return "", 0, fmt.Errorf("ionice %q: level must be between 0 and 7", value)
+			}
+			level = n
+		}
+	default:
+		return "", 0, fmt.Errorf("invalid ionice %q (want idle or best-effort[:0-7])", value)
+	}
+	return class, level, nil
+}
+
+// hasLimits reports whether the task restricts the resources of its command
+func (t Task) hasLimits() bool {
+	return t.Nice != 0 || t.IONice != "" || t.MaxMemory > 0
+}
+
+// ByteSize is a number of bytes that may be written in YAML with a K, M or
+// G suffix (powers of 1024), e.g. "512M"
+type ByteSize int64
+
+// UnmarshalText parses a size such as "1G", "512M" or "65536"
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+	s = strings.TrimSuffix(s, "B")
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", text)
+	}
+	*b = ByteSize(n * unit)
+	return nil
+}
+
+// exitCodeOK reports whether a command exit code counts as success
+func (t Task) exitCodeOK(code int) bool {
+	if len(t.OkExitCodes) == 0 {
+		return code == 0
+	}
+	for _, ok := range t.OkExitCodes {
+		if code == ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactRule masks task-specific sensitive values, such as WiFi SSIDs, that
+// the built-in detectors cannot recognize
+type RedactRule struct {
+	Pattern string `yaml:"pattern"`         // regular expression; ^ and $ match at line boundaries
+	Label   string `yaml:"label,omitempty"` // placeholder name, e.g. "ssid" gives [ssid-1]
+}
+
+// PlatformList is a list of platform IDs that may be written in YAML as a
+// single string or a sequence
+type PlatformList []string
+
+// UnmarshalYAML accepts both `platform: arch` and `platform: [arch, debian]`
+func (l *PlatformList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		if value.Value == "" {
+			*l = nil
+		} else {
+			*l = PlatformList{value.Value}
+		}
+		return nil
+	}
+
+	var ids []string
+	if err := value.Decode(&ids); err != nil {
+		return err
+	}
+	*l = ids
+	return nil
 }
 
 // Profile represents a collection of tasks for a specific platform
 type Profile struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description"`
-	Platform    string `yaml:"platform"` // e.g., "arch_linux"
-	Tasks       []Task `yaml:"tasks"`
+	Name         string       `yaml:"name"`
+	Description  string       `yaml:"description"`
+	Platform     PlatformList `yaml:"platform,omitempty"`      // exact distro IDs, e.g., [arch, debian]; "linux" matches any
+	PlatformLike PlatformList `yaml:"platform_like,omitempty"` // distro families, also matching derivatives via ID_LIKE
+	Tasks        []Task       `yaml:"tasks"`
+	Checks       []Check      `yaml:"checks,omitempty"` // health rules over the results of tasks
+
+	category string // default task category, derived from the filename
+	source   int    // index of the source the profile was loaded from
+}
+
+// isGeneric reports whether the profile applies to any Linux system
+func (p Profile) isGeneric() bool {
+	if len(p.PlatformLike) > 0 {
+		return false
+	}
+	for _, id := range p.Platform {
+		if !strings.EqualFold(id, "linux") {
+			return false
+		}
+	}
+	return true
 }
 
 // TaskResult holds the result of executing a task
@@ -61,5 +284,18 @@ type TaskResult struct {
 	Error      string
 	Duration   time.Duration
 	SkipReason string
+	ExitCode   int // -1 if the command did not run or did not exit normally
+	Priority   int
+	Attempts   int    // number of times the command was run
+	Signal     string // signal that terminated the command, e.g. SIGKILL
+	StdoutSize int    // bytes written to stdout, before truncation
+	StderrSize int    // bytes written to stderr, before truncation
+	Escalated  string // method the task ran as root through, e.g. sudo; empty if it ran unprivileged
+
+	// Structured output of collector tasks and of commands with a parser
+	Fields     Record
+	Records    []Record
+	Columns    []string // keys of Records in the order a table shows them
+	ParseError string   // why the parser could not read the output
 }
 
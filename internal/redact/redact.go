@@ -0,0 +1,400 @@
+package redact
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// Level controls how aggressively reports are redacted
+type Level int
+
+const (
+	Off Level = iota
+	Standard
+	Strict
+)
+
+// String returns the flag value of a Level
+func (l Level) String() string {
+	switch l {
+	case Off:
+		return "off"
+	case Standard:
+		return "standard"
+	case Strict:
+		return "strict"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLevel parses a --redact flag value
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "off", "none":
+		return Off, nil
+	case "standard", "":
+		return Standard, nil
+	case "strict":
+		return Strict, nil
+	default:
+		return Off, fmt.Errorf("unknown redaction level %q (want strict, standard or off)", s)
+	}
+}
+
+// detector finds one kind of sensitive value
+type detector struct {
+	label   string
+	level   Level // minimum level at which the detector is active
+	pattern *regexp.Regexp
+	// keep reports whether a match should be left alone at the given level
+	keep func(match string, level Level) bool
+}
+
+// Built-in detectors, in the order they are applied. Secrets go first so
+// that a token is not partially replaced by a more generic detector.
+var detectors = []detector{
+	{
+		label:   "secret",
+		level:   Standard,
+		pattern: regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+	},
+	{
+		label: "secret",
+		level: Standard,
+		pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,}|glpat-[A-Za-z0-9_-]{20,}|` +
+			`xox[abprs]-[A-Za-z0-9-]{10,}|AKIA[0-9A-Z]{16}|sk-[A-Za-z0-9_-]{20,}|` +
+			`eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`),
+	},
+	{
+		// key=value style credentials; only the value is replaced
+		label:   "secret",
+		level:   Standard,
+		pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|passphrase|secret|token|api[_-]?key|access[_-]?key|psk|auth)\b["']?\s*[:=]\s*["']?([^\s"',;]+)`),
+	},
+	{
+		label:   "email",
+		level:   Standard,
+		pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+		keep:    keepUnit,
+	},
+	{
+		label:   "mac",
+		level:   Standard,
+		pattern: regexp.MustCompile(`\b[0-9A-Fa-f]{2}(?:[:-][0-9A-Fa-f]{2}){5}\b`),
+		keep: func(match string, _ Level) bool {
+			m := strings.ToLower(strings.ReplaceAll(match, "-", ":"))
+			return m == "00:00:00:00:00:00" || m == "ff:ff:ff:ff:ff:ff"
+		},
+	},
+	{
+		// The IPv4 branch takes a whole run of dotted numbers, so keepIP sees
+		// a version such as 6.1.0.25.1 whole instead of an address in it
+		label:   "ip",
+		level:   Standard,
+		pattern: regexp.MustCompile(`\b(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}(?:%[A-Za-z0-9]+)?|\b\d+(?:\.\d+){3,}\b`),
+		keep:    keepIP,
+	},
+	{
+		label:   "uuid",
+		level:   Standard,
+		pattern: regexp.MustCompile(`\b[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\b`),
+	},
+	{
+		// machine-id, boot-id and similar 128-bit identifiers
+		label:   "id",
+		level:   Strict,
+		pattern: regexp.MustCompile(`\b[0-9a-f]{32}\b`),
+	},
+	{
+		label:   "serial",
+		level:   Strict,
+		pattern: regexp.MustCompile(`(?i)\bserial(?:[ _]?number)?\b["']?\s*[:=]\s*["']?([^\s"',;]+)`),
+	},
+}
+
+// unitSuffix matches the systemd unit types, whose template instances
+// (getty@tty1.service) look like email addresses
+var unitSuffix = regexp.MustCompile(`\.(?:service|socket|mount|timer|target|path|slice|scope|device|swap)$`)
+
+// keepUnit leaves systemd template unit names alone
+func keepUnit(match string, _ Level) bool {
+	return unitSuffix.MatchString(match)
+}
+
+// keepIP leaves loopback and unspecified addresses alone, and private and
+// link-local ones too unless the level is strict
+func keepIP(match string, level Level) bool {
+	host, _, _ := strings.Cut(match, "%")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// Not an address after all, e.g. a time of day, a MAC fragment, a
+		// number above 255 or a run of more than four numbers
+		return true
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return true
+	}
+	// Netmasks
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 255 {
+		return true
+	}
+	if level < Strict && (ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+		return true
+	}
+	return false
+}
+
+// homePath matches a home directory and captures the user name
+var homePath = regexp.MustCompile(`/home/([A-Za-z0-9._-]+)`)
+
+// rule is a compiled per-task probe.RedactRule
+type rule struct {
+	label   string
+	pattern *regexp.Regexp
+}
+
+// Redactor masks sensitive values in task results. The same value is always
+// replaced by the same placeholder, so relationships between tasks survive.
+type Redactor struct {
+	level     Level
+	taskRules map[string][]rule
+	literals  []rule // exact values such as the hostname and user name
+
+	mu         sync.Mutex
+	pseudonyms map[string]string // label + value to placeholder
+	counters   map[string]int
+}
+
+// New creates a redactor for the given level, seeded with the local
+// hostname and user name
+func New(level Level) *Redactor {
+	r := NewEmpty(level)
+
+	if hostname, err := os.Hostname(); err == nil {
+		r.AddLiteral(hostname, "host")
+		if short, _, found := strings.Cut(hostname, "."); found {
+			r.AddLiteral(short, "host")
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		r.AddLiteral(u.Username, "user")
+	}
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		r.AddLiteral(sudoUser, "user")
+	}
+
+	return r
+}
+
+// NewEmpty creates a redactor that knows no local values, for output that
+// was not collected on this machine, such as a replayed fixture
+func NewEmpty(level Level) *Redactor {
+	return &Redactor{
+		level:      level,
+		taskRules:  make(map[string][]rule),
+		pseudonyms: make(map[string]string),
+		counters:   make(map[string]int),
+	}
+}
+
+// Level returns the redaction level
+func (r *Redactor) Level() Level {
+	return r.level
+}
+
+// AddLiteral registers an exact value, such as a hostname, to be replaced
+// wherever it appears as a whole word. Short and generic values are ignored.
+func (r *Redactor) AddLiteral(value, label string) {
+	switch strings.ToLower(value) {
+	case "", "root", "localhost", "user", "admin":
+		return
+	}
+	if len(value) < 3 {
+		return
+	}
+
+	pattern := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(value) + `\b`)
+	r.literals = append(r.literals, rule{label: label, pattern: pattern})
+
+	// Longer values first, so "host.example.com" wins over "host"
+	sort.SliceStable(r.literals, func(i, j int) bool {
+		return len(r.literals[i].pattern.String()) > len(r.literals[j].pattern.String())
+	})
+}
+
+// AddTaskRules compiles the `redact:` rules declared by tasks
+func (r *Redactor) AddTaskRules(tasks []probe.Task) error {
+	for _, task := range tasks {
+		for _, tr := range task.Redact {
+			// Anchors match at line boundaries, as output is line oriented
+			pattern, err := regexp.Compile("(?m)" + tr.Pattern)
+			if err != nil {
+				return fmt.Errorf("task %q: invalid redact pattern: %w", task.Name, err)
+			}
+			label := tr.Label
+			if label == "" {
+				label = "redacted"
+			}
+			r.taskRules[task.Name] = append(r.taskRules[task.Name], rule{label: label, pattern: pattern})
+		}
+	}
+	return nil
+}
+
+// Results returns a redacted copy of the task results
+func (r *Redactor) Results(results []probe.TaskResult) []probe.TaskResult {
+	redacted := make([]probe.TaskResult, len(results))
+	for i, result := range results {
+		result.Output = r.Text(result.Name, result.Output)
+		result.Error = r.Text(result.Name, result.Error)
+		result.Fields = r.record(result.Name, result.Fields)
+		if result.Records != nil {
+			records := make([]probe.Record, len(result.Records))
+			for j, record := range result.Records {
+				records[j] = r.record(result.Name, record)
+			}
+			result.Records = records
+		}
+		redacted[i] = result
+	}
+	return redacted
+}
+
+// record returns a copy of a structured record with its string values
+// redacted, including those nested in lists and maps
+func (r *Redactor) record(taskName string, record probe.Record) probe.Record {
+	if record == nil || r.level == Off {
+		return record
+	}
+	redacted := make(probe.Record, len(record))
+	for key, value := range record {
+		redacted[key] = r.value(taskName, value)
+	}
+	return redacted
+}
+
+// value returns a copy of a record value with its strings redacted
+func (r *Redactor) value(taskName string, value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.Text(taskName, v)
+	case []string:
+		redacted := make([]string, len(v))
+		for i, s := range v {
+			redacted[i] = r.Text(taskName, s)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, item := range v {
+			redacted[i] = r.value(taskName, item)
+		}
+		return redacted
+	case probe.Record:
+		return r.record(taskName, v)
+	case map[string]any:
+		return map[string]any(r.record(taskName, v))
+	case []probe.Record:
+		redacted := make([]probe.Record, len(v))
+		for i, record := range v {
+			redacted[i] = r.record(taskName, record)
+		}
+		return redacted
+	}
+	return value
+}
+
+// Text redacts the output of the named task
+func (r *Redactor) Text(taskName, text string) string {
+	if r.level == Off || text == "" {
+		return text
+	}
+
+	for _, tr := range r.taskRules[taskName] {
+		text = r.replace(text, tr.pattern, tr.label, nil)
+	}
+
+	for _, d := range detectors {
+		if r.level < d.level {
+			continue
+		}
+		text = r.replace(text, d.pattern, d.label, d.keep)
+	}
+
+	// Home directories reveal user names even for other accounts
+	text = r.replace(text, homePath, "user", nil)
+
+	for _, literal := range r.literals {
+		text = r.replace(text, literal.pattern, literal.label, nil)
+	}
+
+	return text
+}
+
+// replace substitutes every match of pattern with a placeholder. If the
+// pattern has a capture group only the first group is replaced.
+func (r *Redactor) replace(text string, pattern *regexp.Regexp, label string, keep func(string, Level) bool) string {
+	matches := pattern.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+
+		value := text[start:end]
+		if value == "" || (keep != nil && keep(value, r.level)) || isPlaceholder(text, start, end) {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString(r.pseudonym(label, value))
+		last = end
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
+
+// isPlaceholder reports whether text[start:end] is inside an existing placeholder
+func isPlaceholder(text string, start, end int) bool {
+	open := strings.LastIndex(text[:start], "[")
+	if open < 0 || strings.Contains(text[open:start], "]") {
+		return false
+	}
+	close := strings.Index(text[end:], "]")
+	return close >= 0 && placeholderPattern.MatchString(text[open:end+close+1])
+}
+
+// placeholderPattern matches the placeholders produced by pseudonym
+var placeholderPattern = regexp.MustCompile(`^\[[a-z]+-\d+\]$`)
+
+// pseudonym returns the stable placeholder for a value
+func (r *Redactor) pseudonym(label, value string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := label + "\x00" + strings.ToLower(value)
+	if placeholder, ok := r.pseudonyms[key]; ok {
+		return placeholder
+	}
+
+	r.counters[label]++
+	placeholder := fmt.Sprintf("[%s-%d]", label, r.counters[label])
+	r.pseudonyms[key] = placeholder
+	return placeholder
+}
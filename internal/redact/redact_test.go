@@ -0,0 +1,56 @@
+package redact
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// TestNestedRecords checks that strings nested in record values are redacted
+func TestNestedRecords(t *testing.T) {
+	r := New(Standard)
+	results := r.Results([]probe.TaskResult{{
+		Name: "Links",
+		Fields: probe.Record{
+			"gateway": "83.24.117.9",
+			"peers":   []any{"83.24.117.10", probe.Record{"addr": "83.24.117.11"}},
+			"dns":     []string{"83.24.117.12"},
+			"iface":   map[string]any{"addrs": []any{"83.24.117.13"}, "mtu": int64(1500)},
+		},
+	}})
+
+	fields := results[0].Fields
+	if strings.Contains(fmt.Sprint(fields), "83.24.117") {
+		t.Errorf("addresses left in %v", fields)
+	}
+	if fields["iface"].(map[string]any)["mtu"] != int64(1500) {
+		t.Errorf("non-string value changed: %v", fields["iface"])
+	}
+}
+
+// TestLookalikes checks that unit names and version strings are not taken
+// for email or IP addresses
+func TestLookalikes(t *testing.T) {
+	r := New(Standard)
+	for _, text := range []string{
+		"getty@tty1.service",
+		"wg-quick@wg0.service",
+		"user@1000.service",
+		"linux 6.1.0.25.1",
+		"firmware 1.2.3.4.5",
+		"release 2024.10.3.1",
+		"build 10.0.300.1",
+	} {
+		if got := r.Text("Units", text); got != text {
+			t.Errorf("%q redacted to %q", text, got)
+		}
+	}
+
+	for _, text := range []string{"mail kasia@example.org", "peer 83.24.117.9.", "via 1.2.3.4 dev eth0"} {
+		if got := r.Text("Units", text); got == text {
+			t.Errorf("%q not redacted", text)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package report
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+const (
+	// Lines kept from the start and end of an output truncated for the budget
+	BudgetHeadLines = 15
+	BudgetTailLines = 10
+
+	// Rough per-task markup overhead (heading, fence, command line)
+	taskOverheadTokens = 12
+)
+
+// fit selects, truncates and drops results so that the report rendered by
+// generate stays within r.MaxTokens. Successful tasks are considered in
+// order of priority; failed and skipped tasks are listed unless they alone
+// exceed the budget, in which case the report is cut short.
+func (r *MarkdownReport) fit(generate func(*MarkdownReport) (string, int, error)) (string, int, error) {
+	work := *r
+	work.MaxTokens = 0
+
+	// Everything may already fit
+	content, tokenCount, err := generate(&work)
+	if err != nil || tokenCount <= r.MaxTokens {
+		return content, tokenCount, err
+	}
+
+	count := tokenCounterFunc()
+	order := r.priorityOrder()
+
+	// Start from a report with no successful task output at all
+	kept := make(map[int]probe.TaskResult)
+	work.Results, work.omitted = r.assemble(kept)
+	_, used, err := generate(&work)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Greedily add tasks, truncating long outputs that do not fit whole
+	for _, i := range order {
+		result := r.Results[i]
+		saving := count(omittedLine(result))
+
+		cost := count(result.Name+result.Command+result.Output) + taskOverheadTokens
+		if used+cost-saving <= r.MaxTokens {
+			kept[i] = result
+			used += cost - saving
+			continue
+		}
+
+		truncated := result
+		truncated.Output = headTail(result.Output, BudgetHeadLines, BudgetTailLines)
+		truncated.Columns = nil // shown as the truncated output, not as a full table
+		if truncated.Output == result.Output {
+			continue
+		}
+		cost = count(truncated.Name+truncated.Command+truncated.Output) + taskOverheadTokens
+		if used+cost-saving <= r.MaxTokens {
+			kept[i] = truncated
+			used += cost - saving
+		}
+	}
+
+	// The estimate is approximate, so drop the least important tasks until
+	// the rendered report really fits
+	for {
+		work.Results, work.omitted = r.assemble(kept)
+		content, tokenCount, err = generate(&work)
+		if err != nil || tokenCount <= r.MaxTokens {
+			return content, tokenCount, err
+		}
+		if len(kept) == 0 {
+			content, tokenCount = recountHeader(cutToBudget(content, r.MaxTokens, count), count)
+			return content, tokenCount, nil
+		}
+
+		for j := len(order) - 1; j >= 0; j-- {
+			if _, ok := kept[order[j]]; ok {
+				delete(kept, order[j])
+				break
+			}
+		}
+	}
+}
+
+// priorityOrder returns the indices of successful results, most important
+// first: by task priority, then by the highest priority in the task's
+// category, then in report order
+func (r *MarkdownReport) priorityOrder() []int {
+	categoryPriority := make(map[string]int)
+	for _, result := range r.Results {
+		if p, ok := categoryPriority[result.Category]; !ok || result.Priority > p {
+			categoryPriority[result.Category] = result.Priority
+		}
+	}
+
+	var order []int
+	for i, result := range r.Results {
+		if result.Status == probe.StatusSuccess {
+			order = append(order, i)
+		}
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := r.Results[order[a]], r.Results[order[b]]
+		if ra.Priority != rb.Priority {
+			return ra.Priority > rb.Priority
+		}
+		return categoryPriority[ra.Category] > categoryPriority[rb.Category]
+	})
+
+	return order
+}
+
+// assemble returns the results to render, in their original order, and the
+// successful results that were left out
+func (r *MarkdownReport) assemble(kept map[int]probe.TaskResult) ([]probe.TaskResult, []probe.TaskResult) {
+	var results, omitted []probe.TaskResult
+	for i, result := range r.Results {
+		if result.Status != probe.StatusSuccess {
+			results = append(results, result)
+			continue
+		}
+		if k, ok := kept[i]; ok {
+			results = append(results, k)
+		} else {
+			omitted = append(omitted, result)
+		}
+	}
+	return results, omitted
+}
+
+// writeOmittedSection summarizes the tasks dropped to fit the token budget
+func (r *MarkdownReport) writeOmittedSection(b *strings.Builder) {
+	if len(r.omitted) == 0 {
+		return
+	}
+
+	b.WriteString("\n## Omitted (token budget)\n\n")
+	b.WriteString(fmt.Sprintf("%d successful tasks were left out to fit the token budget. Ask for any of them if needed:\n", len(r.omitted)))
+
+	// One line per category keeps the footer itself cheap
+	var categories []string
+	byCategory := make(map[string][]string)
+	for _, result := range r.omitted {
+		if _, ok := byCategory[result.Category]; !ok {
+			categories = append(categories, result.Category)
+		}
+		byCategory[result.Category] = append(byCategory[result.Category], result.Name)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		b.WriteString(fmt.Sprintf("- %s: %s\n", category, strings.Join(byCategory[category], ", ")))
+	}
+}
+
+// omittedLine approximates the footer text added for an omitted task
+func omittedLine(result probe.TaskResult) string {
+	return result.Name + ", "
+}
+
+// budgetCutNote ends a report cut short to fit the token budget
+const budgetCutNote = "\n... [report cut to fit the token budget]\n"
+
+// cutToBudget keeps as many leading lines of content as fit in maxTokens
+// with a closing note. It is the last resort when no task output is left to
+// drop, so it removes the sections at the end: errors, skipped tasks and the
+// omitted-tasks footer.
+func cutToBudget(content string, maxTokens int, count func(string) int) string {
+	lines := strings.SplitAfter(content, "\n")
+	cut := func(n int) string {
+		kept := strings.Join(lines[:n], "")
+		// Close a code block left open by the cut
+		if strings.Count(kept, "```")%2 == 1 {
+			kept += "```\n"
+		}
+		return kept + budgetCutNote
+	}
+
+	// Find the most lines that fit
+	n := sort.Search(len(lines)+1, func(n int) bool {
+		return count(cut(n)) > maxTokens
+	}) - 1
+	if n < 0 {
+		return ""
+	}
+	return cut(n)
+}
+
+// tokenCountHeader matches the token count in the header of a report
+var tokenCountHeader = regexp.MustCompile(`(?m)^Token Count: \d+$`)
+
+// recountHeader updates the token count in the header of a report that was
+// cut short, which still counts the whole report, and returns the count.
+// The new number is no larger than the one the report was cut with.
+func recountHeader(content string, count func(string) int) (string, int) {
+	tokenCount := count(content)
+	loc := tokenCountHeader.FindStringIndex(content)
+	if loc == nil {
+		return content, tokenCount
+	}
+
+	// A different number can tokenize differently, so recount until the
+	// header agrees
+	head, tail := content[:loc[0]], content[loc[1]:]
+	for range 3 {
+		content = head + fmt.Sprintf("Token Count: %d", tokenCount) + tail
+		n := count(content)
+		if n == tokenCount {
+			break
+		}
+		tokenCount = n
+	}
+	return content, tokenCount
+}
+
+// headTail keeps the first head and last tail lines of output
+func headTail(output string, head, tail int) string {
+	lines := strings.Split(output, "\n")
+	if len(lines) <= head+tail+1 {
+		return output
+	}
+
+	omitted := len(lines) - head - tail
+	kept := append([]string{}, lines[:head]...)
+	kept = append(kept, fmt.Sprintf("... [%d lines omitted for token budget] ...", omitted))
+	kept = append(kept, lines[len(lines)-tail:]...)
+	return strings.Join(kept, "\n")
+}
+
+// tokenCounterFunc returns a token counting function, falling back to a
+// rough estimate if the tokenizer is unavailable
+func tokenCounterFunc() func(string) int {
+	tc, err := NewTokenCounter()
+	if err != nil {
+		return func(s string) int { return len(s) / 4 }
+	}
+	return tc.Count
+}
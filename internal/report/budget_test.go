@@ -0,0 +1,43 @@
+package report_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+	"github.com/pkrzeminski/sysprobe/internal/report"
+)
+
+// TestBudgetCap checks that the budget holds when the tasks that cannot be
+// dropped alone exceed it
+func TestBudgetCap(t *testing.T) {
+	var results []probe.TaskResult
+	for i := range 200 {
+		results = append(results, probe.TaskResult{
+			Name:     fmt.Sprintf("Missing Tool %d", i),
+			Category: "system",
+			Status:   probe.StatusSkipped,
+			Error:    "Missing dependency: some-long-tool-name",
+		})
+	}
+	results = append(results, probe.TaskResult{Name: "Kernel", Category: "system", Status: probe.StatusSuccess, Output: "6.9.7"})
+
+	rep := report.NewMarkdownReport(platform.Platform{OS: "linux", Distro: "arch"}, results)
+	rep.MaxTokens = 300
+	content, tokenCount, err := rep.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenCount > rep.MaxTokens {
+		t.Errorf("%d tokens, over the budget of %d", tokenCount, rep.MaxTokens)
+	}
+	if !strings.Contains(content, "report cut to fit the token budget") || !strings.HasPrefix(content, "# ") {
+		t.Errorf("report:\n%s", content)
+	}
+	// The header counts the report as cut, not as it was before
+	if header := fmt.Sprintf("\nToken Count: %d\n", tokenCount); !strings.Contains(content, header) {
+		t.Errorf("report of %d tokens has another count in its header:\n%s", tokenCount, content)
+	}
+}
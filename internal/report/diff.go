@@ -0,0 +1,221 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/diff"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// DefaultDiffContext is the number of unchanged lines shown around each change
+const DefaultDiffContext = 3
+
+// TaskChange describes how a single task differs between two reports
+type TaskChange struct {
+	Category string
+	Name     string
+	Old      *JSONTask // nil if the task was added
+	New      *JSONTask // nil if the task was removed
+	Stdout   string    // unified diff of stdout, empty if unchanged
+	Stderr   string    // unified diff of stderr, empty if unchanged
+}
+
+// StatusChanged reports whether the task status differs
+func (c TaskChange) StatusChanged() bool {
+	return c.Old != nil && c.New != nil && c.Old.Status != c.New.Status
+}
+
+// DiffReport compares two JSON reports and renders what changed
+type DiffReport struct {
+	Old     JSONDocument
+	New     JSONDocument
+	Context int
+}
+
+// NewDiffReport creates a new diff report generator
+func NewDiffReport(old, new JSONDocument) *DiffReport {
+	return &DiffReport{
+		Old:     old,
+		New:     new,
+		Context: DefaultDiffContext,
+	}
+}
+
+// Changes matches tasks by category and name and returns those that differ,
+// in the order of the new report followed by removed tasks
+func (r *DiffReport) Changes() []TaskChange {
+	type key struct{ category, name string }
+
+	oldTasks := make(map[key]*JSONTask)
+	for i := range r.Old.Tasks {
+		t := &r.Old.Tasks[i]
+		oldTasks[key{t.Category, t.Name}] = t
+	}
+
+	var changes []TaskChange
+	seen := make(map[key]bool)
+
+	for i := range r.New.Tasks {
+		newTask := &r.New.Tasks[i]
+		k := key{newTask.Category, newTask.Name}
+		seen[k] = true
+
+		oldTask, ok := oldTasks[k]
+		if !ok {
+			changes = append(changes, TaskChange{Category: k.category, Name: k.name, New: newTask})
+			continue
+		}
+
+		change := TaskChange{
+			Category: k.category,
+			Name:     k.name,
+			Old:      oldTask,
+			New:      newTask,
+			Stdout:   diff.Unified("old/stdout", "new/stdout", oldTask.Stdout, newTask.Stdout, r.Context),
+			Stderr:   diff.Unified("old/stderr", "new/stderr", oldTask.Stderr, newTask.Stderr, r.Context),
+		}
+		if change.StatusChanged() || change.Stdout != "" || change.Stderr != "" {
+			changes = append(changes, change)
+		}
+	}
+
+	for i := range r.Old.Tasks {
+		oldTask := &r.Old.Tasks[i]
+		k := key{oldTask.Category, oldTask.Name}
+		if !seen[k] {
+			changes = append(changes, TaskChange{Category: k.category, Name: k.name, Old: oldTask})
+		}
+	}
+
+	return changes
+}
+
+// Generate creates the markdown "what changed" report
+func (r *DiffReport) Generate() (string, int, error) {
+	content := r.generateContent()
+
+	tc, err := NewTokenCounter()
+	if err != nil {
+		// Fall back to rough estimate if tokenizer fails
+		tokenCount := len(content) / 4
+		return r.generateWithTokenCount(tokenCount, content), tokenCount, nil
+	}
+
+	tokenCount := tc.Count(content)
+	report := r.generateWithTokenCount(tokenCount, content)
+	return report, tc.Count(report), nil
+}
+
+// generateWithTokenCount prepends the header to the report content
+func (r *DiffReport) generateWithTokenCount(tokenCount int, content string) string {
+	var b strings.Builder
+
+	b.WriteString("# SysProbe Change Report\n\n")
+	b.WriteString("Compares two diagnostic runs of the same system. Focus on what changed between them.\n\n")
+	b.WriteString(fmt.Sprintf("Before: %s (%s)\n", r.Old.Generated.Format(time.RFC3339), r.Old.Platform.DistroID))
+	b.WriteString(fmt.Sprintf("After: %s (%s)\n", r.New.Generated.Format(time.RFC3339), r.New.Platform.DistroID))
+	b.WriteString(fmt.Sprintf("Token Count: %d\n", tokenCount))
+	b.WriteString(content)
+
+	return b.String()
+}
+
+// generateContent renders the changes without the header
+func (r *DiffReport) generateContent() string {
+	var b strings.Builder
+	changes := r.Changes()
+
+	var statusChanges, outputChanges, added, removed []TaskChange
+	for _, c := range changes {
+		switch {
+		case c.Old == nil:
+			added = append(added, c)
+		case c.New == nil:
+			removed = append(removed, c)
+		default:
+			if c.StatusChanged() {
+				statusChanges = append(statusChanges, c)
+			}
+			if c.Stdout != "" || c.Stderr != "" {
+				outputChanges = append(outputChanges, c)
+			}
+		}
+	}
+
+	b.WriteString("\n## Summary\n\n")
+	if len(changes) == 0 {
+		b.WriteString("No differences found.\n")
+		return b.String()
+	}
+	b.WriteString(fmt.Sprintf("- Status changes: %d\n", len(statusChanges)))
+	b.WriteString(fmt.Sprintf("- Output changes: %d\n", len(outputChanges)))
+	b.WriteString(fmt.Sprintf("- New tasks: %d\n", len(added)))
+	b.WriteString(fmt.Sprintf("- Removed tasks: %d\n", len(removed)))
+
+	if len(statusChanges) > 0 {
+		b.WriteString("\n## Status Changes\n\n")
+		for _, c := range statusChanges {
+			b.WriteString(fmt.Sprintf("- **%s**: %s\n", taskLabel(c), describeTransition(c.Old, c.New)))
+		}
+	}
+
+	if len(outputChanges) > 0 {
+		b.WriteString("\n## Output Changes\n")
+		for _, c := range outputChanges {
+			b.WriteString(fmt.Sprintf("\n### %s\n", taskLabel(c)))
+			b.WriteString(fmt.Sprintf("```diff\n$ %s\n", c.New.Command))
+			b.WriteString(c.Stdout)
+			b.WriteString(c.Stderr)
+			b.WriteString("```\n")
+		}
+	}
+
+	if len(added) > 0 {
+		b.WriteString("\n## New Tasks\n\n")
+		for _, c := range added {
+			b.WriteString(fmt.Sprintf("- **%s**: %s\n", taskLabel(c), describeStatus(c.New)))
+		}
+	}
+
+	if len(removed) > 0 {
+		b.WriteString("\n## Removed Tasks\n\n")
+		for _, c := range removed {
+			b.WriteString(fmt.Sprintf("- **%s**: was %s\n", taskLabel(c), describeStatus(c.Old)))
+		}
+	}
+
+	return b.String()
+}
+
+// taskLabel returns "Category / Name" for a change
+func taskLabel(c TaskChange) string {
+	category := c.Category
+	if category == "" {
+		category = "General"
+	}
+	return strings.Title(category) + " / " + c.Name
+}
+
+// describeTransition renders a status change such as "Success → Failed (exit 1)"
+func describeTransition(old, new *JSONTask) string {
+	if new.Status == probe.StatusSkipped {
+		return fmt.Sprintf("newly skipped (%s), was %s", new.SkipReason, describeStatus(old))
+	}
+	return fmt.Sprintf("%s → %s", old.Status, describeStatus(new))
+}
+
+// describeStatus renders a task status with its most relevant detail
+func describeStatus(t *JSONTask) string {
+	switch t.Status {
+	case probe.StatusSkipped:
+		return fmt.Sprintf("%s (%s)", t.Status, t.SkipReason)
+	case probe.StatusFailed:
+		return fmt.Sprintf("%s (exit %d)", t.Status, t.ExitCode)
+	case probe.StatusTimedOut, probe.StatusCancelled:
+		return fmt.Sprintf("%s (%s)", t.Status, t.Stderr)
+	default:
+		return t.Status.String()
+	}
+}
@@ -0,0 +1,183 @@
+package report_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+	"github.com/pkrzeminski/sysprobe/internal/redact"
+	"github.com/pkrzeminski/sysprobe/internal/report"
+)
+
+// update rewrites the golden files: go test ./internal/report -update
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// Values in the fixtures that redact.New would take from the recording
+// machine, as label and value
+var fixtureLiterals = [][2]string{
+	{"host", "archbox"},
+	{"user", "alex"},
+}
+
+// goldenCase is one way of rendering a replayed run
+type goldenCase struct {
+	file  string
+	level redact.Level
+	opts  report.Options
+}
+
+var goldenCases = []goldenCase{
+	{"full.md", redact.Standard, report.Options{}},
+	{"minified.md", redact.Standard, report.Options{Mode: report.ModeMinified}},
+	{"intro.md", redact.Standard, report.Options{Mode: report.ModeIntro}},
+	{"budget.md", redact.Standard, report.Options{MaxTokens: 1200}},
+	{"strict.md", redact.Strict, report.Options{}},
+	{"unredacted.md", redact.Off, report.Options{}},
+	{"report.json", redact.Standard, report.Options{Format: report.FormatJSON}},
+}
+
+// TestGolden replays every fixture in testdata through the embedded probes
+// and compares the reports with testdata/golden/<fixture>/
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata")
+	}
+
+	for _, path := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(path), ".fixture.json")
+		t.Run(name, func(t *testing.T) {
+			fixture, err := probe.LoadFixture(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tasks := recordedTasks(t, fixture)
+			checks := embeddedChecks(t, fixture)
+
+			for _, c := range goldenCases {
+				t.Run(c.file, func(t *testing.T) {
+					results := replay(t, fixture, tasks, c.level)
+					findings, err := probe.EvaluateChecks(checks, results)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					opts := c.opts
+					opts.Generated = fixture.Recorded
+					opts.Findings = findings
+					got, _, err := report.Render(fixture.Platform, results, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					checkGolden(t, filepath.Join("testdata", "golden", name, c.file), got)
+				})
+			}
+		})
+	}
+}
+
+// recordedTasks loads the embedded probes for the fixture's platform and
+// keeps the tasks the fixture has a record of
+func recordedTasks(t *testing.T, fixture *probe.Fixture) []probe.Task {
+	t.Helper()
+	all, err := embeddedLoader(t, fixture).GetAllTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := fixture.Filter(all)
+	if len(tasks) != len(fixture.Tasks) {
+		t.Fatalf("fixture has %d tasks, %d of them are in the probes", len(fixture.Tasks), len(tasks))
+	}
+	return tasks
+}
+
+// embeddedChecks loads the checks of the embedded probes for the fixture's
+// platform
+func embeddedChecks(t *testing.T, fixture *probe.Fixture) []probe.Check {
+	t.Helper()
+	checks, err := embeddedLoader(t, fixture).GetAllChecks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checks
+}
+
+// embeddedLoader returns a loader of the embedded probes for the fixture's
+// platform
+func embeddedLoader(t *testing.T, fixture *probe.Fixture) *probe.Loader {
+	t.Helper()
+	embedded, err := fs.Sub(sysprobe.ProbeFS, "probes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return probe.NewLoader([]fs.FS{embedded}, fixture.Platform)
+}
+
+// replay runs tasks from the fixture and redacts the results at level
+func replay(t *testing.T, fixture *probe.Fixture, tasks []probe.Task, level redact.Level) []probe.TaskResult {
+	t.Helper()
+	runner := probe.NewRunner(fixture.Platform)
+	runner.Replay = fixture
+	results := probe.NewPool(runner, probe.DefaultWorkers).Run(context.Background(), tasks)
+
+	redactor := redact.NewEmpty(level)
+	for _, literal := range fixtureLiterals {
+		redactor.AddLiteral(literal[1], literal[0])
+	}
+	if err := redactor.AddTaskRules(tasks); err != nil {
+		t.Fatal(err)
+	}
+	return redactor.Results(results)
+}
+
+// checkGolden compares got with a golden file, or rewrites it with -update
+func checkGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("report differs from %s (run go test with -update to accept):\n%s", path, firstDifference(string(want), got))
+	}
+}
+
+// firstDifference shows the first line where two texts differ
+func firstDifference(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return "(line endings differ)"
+}
@@ -0,0 +1,295 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+const (
+	// JSONSchema identifies sysprobe JSON reports
+	JSONSchema = "sysprobe.report"
+
+	// JSONSchemaVersion is bumped on any incompatible change to the
+	// document layout. Adding fields is not considered incompatible.
+	JSONSchemaVersion = 1
+)
+
+// JSONDocument is the top-level structure of a JSON report
+type JSONDocument struct {
+	Schema    string            `json:"schema"`
+	Version   int               `json:"version"`
+	Generated time.Time         `json:"generated"`
+	Platform  platform.Platform `json:"platform"`
+	Summary   JSONSummary       `json:"summary"`
+	Findings  []probe.Issue     `json:"findings,omitempty"` // issues found by manifest checks, most serious first
+	Tasks     []JSONTask        `json:"tasks,omitempty"`
+}
+
+// JSONSummary holds aggregate counts for a report
+type JSONSummary struct {
+	Total     int `json:"total"`
+	Success   int `json:"success"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+	TimedOut  int `json:"timed_out"`
+	Cancelled int `json:"cancelled"`
+	Tokens    int `json:"tokens"` // sum of the per-task output tokens
+}
+
+// JSONTask is the serialized form of a probe.TaskResult
+type JSONTask struct {
+	Name       string         `json:"name"`
+	Category   string         `json:"category"`
+	Command    string         `json:"command"`
+	Status     probe.Status   `json:"status"`
+	DurationMS float64        `json:"duration_ms"`
+	ExitCode   int            `json:"exit_code"`
+	Signal     string         `json:"signal,omitempty"` // e.g. "SIGKILL" if the command was killed
+	Stdout     string         `json:"stdout"`
+	Stderr     string         `json:"stderr"`
+	StdoutSize int            `json:"stdout_bytes"` // size before truncation
+	StderrSize int            `json:"stderr_bytes"`
+	SkipReason string         `json:"skip_reason,omitempty"`
+	Escalated  string         `json:"escalated,omitempty"` // e.g. "sudo" if the command ran as root through --escalate
+	Attempts   int            `json:"attempts,omitempty"`
+	Priority   int            `json:"priority,omitempty"`
+	Tokens     int            `json:"tokens"`
+	Fields     probe.Record   `json:"fields,omitempty"`      // structured facts from a collector or parser
+	Records    []probe.Record `json:"records,omitempty"`     // structured items from a collector or parser
+	Columns    []string       `json:"columns,omitempty"`     // keys of the records in table order
+	ParseError string         `json:"parse_error,omitempty"` // why the parser could not read stdout
+}
+
+// jsonLine is a single record of a JSONL report. The first line has type
+// "report" and carries everything but the tasks, which follow one per line
+// with type "task".
+type jsonLine struct {
+	Type string `json:"type"`
+	*JSONDocument
+	*JSONTask
+}
+
+// JSONReport generates machine-readable reports
+type JSONReport struct {
+	Platform  platform.Platform
+	Results   []probe.TaskResult
+	Generated time.Time
+	Findings  []probe.Issue
+}
+
+// NewJSONReport creates a new JSON report generator
+func NewJSONReport(p platform.Platform, results []probe.TaskResult) *JSONReport {
+	return &JSONReport{
+		Platform:  p,
+		Results:   results,
+		Generated: time.Now(),
+	}
+}
+
+// Document builds the report document
+func (r *JSONReport) Document() JSONDocument {
+	doc := JSONDocument{
+		Schema:    JSONSchema,
+		Version:   JSONSchemaVersion,
+		Generated: r.Generated,
+		Platform:  r.Platform,
+		Findings:  r.Findings,
+		Tasks:     make([]JSONTask, 0, len(r.Results)),
+	}
+
+	// Token counting is best effort, as in the markdown report
+	tc, _ := NewTokenCounter()
+
+	for _, result := range r.Results {
+		task := JSONTask{
+			Name:       result.Name,
+			Category:   result.Category,
+			Command:    result.Command,
+			Status:     result.Status,
+			DurationMS: float64(result.Duration) / float64(time.Millisecond),
+			ExitCode:   result.ExitCode,
+			Signal:     result.Signal,
+			Stdout:     result.Output,
+			Stderr:     result.Error,
+			StdoutSize: result.StdoutSize,
+			StderrSize: result.StderrSize,
+			SkipReason: result.SkipReason,
+			Escalated:  result.Escalated,
+			Priority:   result.Priority,
+			Attempts:   result.Attempts,
+			Fields:     result.Fields,
+			Records:    result.Records,
+			Columns:    result.Columns,
+			ParseError: result.ParseError,
+		}
+		if tc != nil {
+			task.Tokens = tc.Count(result.Output) + tc.Count(result.Error)
+		} else {
+			task.Tokens = (len(result.Output) + len(result.Error)) / 4
+		}
+
+		doc.Summary.Total++
+		doc.Summary.Tokens += task.Tokens
+		switch result.Status {
+		case probe.StatusSuccess:
+			doc.Summary.Success++
+		case probe.StatusFailed:
+			doc.Summary.Failed++
+		case probe.StatusSkipped:
+			doc.Summary.Skipped++
+		case probe.StatusTimedOut:
+			doc.Summary.TimedOut++
+		case probe.StatusCancelled:
+			doc.Summary.Cancelled++
+		}
+
+		doc.Tasks = append(doc.Tasks, task)
+	}
+
+	return doc
+}
+
+// Results converts the tasks of a report back into task results, so that a
+// saved report can be rendered again
+func (d JSONDocument) Results() []probe.TaskResult {
+	results := make([]probe.TaskResult, 0, len(d.Tasks))
+	for _, task := range d.Tasks {
+		results = append(results, probe.TaskResult{
+			Name:       task.Name,
+			Command:    task.Command,
+			Category:   task.Category,
+			Status:     task.Status,
+			Output:     task.Stdout,
+			Error:      task.Stderr,
+			Duration:   time.Duration(task.DurationMS * float64(time.Millisecond)),
+			SkipReason: task.SkipReason,
+			Escalated:  task.Escalated,
+			ExitCode:   task.ExitCode,
+			Signal:     task.Signal,
+			StdoutSize: task.StdoutSize,
+			StderrSize: task.StderrSize,
+			Priority:   task.Priority,
+			Attempts:   task.Attempts,
+			Fields:     task.Fields,
+			Records:    task.Records,
+			Columns:    task.Columns,
+			ParseError: task.ParseError,
+		})
+	}
+	return results
+}
+
+// Generate creates an indented JSON report
+func (r *JSONReport) Generate() (string, int, error) {
+	data, err := json.MarshalIndent(r.Document(), "", "  ")
+	if err != nil {
+		return "", 0, err
+	}
+	return countTokens(string(data) + "\n")
+}
+
+// GenerateMinified creates a compact single-line JSON report
+func (r *JSONReport) GenerateMinified() (string, int, error) {
+	data, err := json.Marshal(r.Document())
+	if err != nil {
+		return "", 0, err
+	}
+	return countTokens(string(data) + "\n")
+}
+
+// GenerateLines creates a JSONL report: a header line followed by one line per task
+func (r *JSONReport) GenerateLines() (string, int, error) {
+	doc := r.Document()
+	tasks := doc.Tasks
+	doc.Tasks = nil
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	if err := enc.Encode(jsonLine{Type: "report", JSONDocument: &doc}); err != nil {
+		return "", 0, err
+	}
+	for i := range tasks {
+		if err := enc.Encode(jsonLine{Type: "task", JSONTask: &tasks[i]}); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return countTokens(buf.String())
+}
+
+// countTokens returns content along with its token count
+func countTokens(content string) (string, int, error) {
+	tc, err := NewTokenCounter()
+	if err != nil {
+		return content, len(content) / 4, nil
+	}
+	return content, tc.Count(content), nil
+}
+
+// ReadJSON parses a report written in either the json or jsonl format
+func ReadJSON(r io.Reader) (JSONDocument, error) {
+	var doc JSONDocument
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return doc, err
+	}
+
+	// A JSONL report starts with a complete header record on its own line
+	firstLine, _, _ := bytes.Cut(bytes.TrimSpace(data), []byte("\n"))
+	var header struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(firstLine, &header) != nil || header.Type != "report" {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return doc, err
+		}
+		return doc, checkSchema(doc)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		record := jsonLine{JSONDocument: &JSONDocument{}, JSONTask: &JSONTask{}}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return doc, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch record.Type {
+		case "report":
+			doc = *record.JSONDocument
+		case "task":
+			doc.Tasks = append(doc.Tasks, *record.JSONTask)
+		default:
+			return doc, fmt.Errorf("line %d: unknown record type %q", line, record.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return doc, err
+	}
+
+	return doc, checkSchema(doc)
+}
+
+// checkSchema rejects documents that are not sysprobe reports of a known version
+func checkSchema(doc JSONDocument) error {
+	if doc.Schema != JSONSchema {
+		return fmt.Errorf("not a sysprobe report (schema %q)", doc.Schema)
+	}
+	if doc.Version > JSONSchemaVersion {
+		return fmt.Errorf("unsupported report version %d (newest known is %d)", doc.Version, JSONSchemaVersion)
+	}
+	return nil
+}
@@ -15,6 +15,14 @@ type MarkdownReport struct {
 	Platform platform.Platform
 	Results  []probe.TaskResult
 	Generated time.Time
+
+	// Findings are the issues found by manifest checks, shown first
+	Findings []probe.Issue
+
+	// MaxTokens is the token budget for the report; 0 means unlimited
+	MaxTokens int
+
+	omitted []probe.TaskResult // tasks dropped to fit the token budget
 }
 
 // NewMarkdownReport creates a new report generator
@@ -28,6 +36,10 @@ func NewMarkdownReport(p platform.Platform, results []probe.TaskResult) *Markdow
 
 // Generate creates the markdown report
 func (r *MarkdownReport) Generate() (string, int, error) {
+	if r.MaxTokens > 0 {
+		return r.fit((*MarkdownReport).Generate)
+	}
+
 	var b strings.Builder
 
 	// Generate report content first (without token count)
@@ -57,6 +69,8 @@ func (r *MarkdownReport) Generate() (string, int, error) {
 // generateContent generates the report without the header token count
 func (r *MarkdownReport) generateContent() string {
 	var b strings.Builder
+
+	r.writeFindings(&b)
 	
 	// Group results by category
 	categories := r.groupByCategory()
@@ -71,6 +85,9 @@ func (r *MarkdownReport) generateContent() string {
 	
 	// Errors and skipped section
 	r.writeErrorsSection(&b)
+
+	// Tasks dropped for the token budget
+	r.writeOmittedSection(&b)
 	
 	return b.String()
 }
@@ -83,6 +100,9 @@ func (r *MarkdownReport) generateWithTokenCount(tokenCount int) string {
 	b.WriteString("# SysProbe Diagnostic Report\n\n")
 	b.WriteString(fmt.Sprintf("Generated: %s\n", r.Generated.Format(time.RFC3339)))
 	b.WriteString(fmt.Sprintf("Platform: %s", r.Platform.DistroID))
+	if r.Platform.VersionID != "" {
+		b.WriteString(" " + r.Platform.VersionID)
+	}
 	if r.Platform.WM != "" {
 		b.WriteString(fmt.Sprintf(" (%s)", r.Platform.WM))
 	}
@@ -135,12 +155,16 @@ func (r *MarkdownReport) groupByCategory() []categoryGroup {
 // writeTaskResult writes a single task result to the report
 func (r *MarkdownReport) writeTaskResult(b *strings.Builder, result probe.TaskResult) {
 	// Skip failed/skipped tasks in main output (they go to errors section)
-	if result.Status == probe.StatusFailed || result.Status == probe.StatusSkipped {
+	if result.Status.IsProblem() || result.Status == probe.StatusSkipped {
 		return
 	}
 	
 	b.WriteString(fmt.Sprintf("\n### %s\n", result.Name))
-	b.WriteString(fmt.Sprintf("```\n$ %s\n", result.Command))
+	if result.Escalated != "" {
+		b.WriteString(fmt.Sprintf("```\n$ %s %s\n", result.Escalated, result.Command))
+	} else {
+		b.WriteString(fmt.Sprintf("```\n$ %s\n", result.Command))
+	}
 	
 	if result.Output != "" {
 		b.WriteString(result.Output)
@@ -159,10 +183,10 @@ func (r *MarkdownReport) writeErrorsSection(b *strings.Builder) {
 	var errors, skipped []probe.TaskResult
 	
 	for _, result := range r.Results {
-		switch result.Status {
-		case probe.StatusFailed:
+		switch {
+		case result.Status.IsProblem():
 			errors = append(errors, result)
-		case probe.StatusSkipped:
+		case result.Status == probe.StatusSkipped:
 			skipped = append(skipped, result)
 		}
 	}
@@ -178,7 +202,14 @@ func (r *MarkdownReport) writeErrorsSection(b *strings.Builder) {
 		if errMsg == "" {
 			errMsg = "Unknown error"
 		}
-		b.WriteString(fmt.Sprintf("- **%s**: Failed (%s)\n", result.Name, errMsg))
+		if result.Status == probe.StatusFailed {
+			if result.Signal != "" && !strings.HasPrefix(errMsg, "killed by") {
+				errMsg = "killed by " + result.Signal + ": " + errMsg
+			} else if result.ExitCode > 0 && !strings.HasPrefix(errMsg, "exit status") {
+				errMsg = fmt.Sprintf("exit %d: %s", result.ExitCode, errMsg)
+			}
+		}
+		b.WriteString(fmt.Sprintf("- **%s**: %s (%s)\n", result.Name, result.Status, errMsg))
 	}
 	
 	for _, result := range skipped {
@@ -192,20 +223,36 @@ func (r *MarkdownReport) writeErrorsSection(b *strings.Builder) {
 
 // GenerateMinified creates a more compact version for constrained contexts
 func (r *MarkdownReport) GenerateMinified() (string, int, error) {
+	if r.MaxTokens > 0 {
+		return r.fit((*MarkdownReport).GenerateMinified)
+	}
+
 	var b strings.Builder
 	
 	b.WriteString("# SysProbe Report\n")
 	b.WriteString(fmt.Sprintf("Time:%s Platform:%s\n", 
 		r.Generated.Format("2006-01-02T15:04"),
 		r.Platform.DistroID))
+
+	r.writeFindings(&b)
 	
 	for _, result := range r.Results {
-		if result.Status == probe.StatusSuccess && result.Output != "" {
-			b.WriteString(fmt.Sprintf("\n## %s\n```\n%s\n```\n", 
-				result.Name, 
-				strings.TrimSpace(result.Output)))
+		if result.Status != probe.StatusSuccess || result.Output == "" {
+			continue
+		}
+		// Parsed output is shown as a table, without the command's padding
+		// and legends
+		if len(result.Columns) > 0 && len(result.Records) > 0 {
+			b.WriteString(fmt.Sprintf("\n## %s\n", result.Name))
+			writeTable(&b, result.Columns, result.Records)
+			continue
 		}
+		b.WriteString(fmt.Sprintf("\n## %s\n```\n%s\n```\n",
+			result.Name,
+			strings.TrimSpace(result.Output)))
 	}
+
+	r.writeOmittedSection(&b)
 	
 	content := b.String()
 	
@@ -220,10 +267,17 @@ func (r *MarkdownReport) GenerateMinified() (string, int, error) {
 
 // GenerateIntro creates a concise system introduction for LLM chat context
 func (r *MarkdownReport) GenerateIntro() (string, int, error) {
+	if r.MaxTokens > 0 {
+		return r.fit((*MarkdownReport).GenerateIntro)
+	}
+
 	var b strings.Builder
 	
 	b.WriteString("# System Context\n\n")
-	b.WriteString("Use this information to understand my environment when helping me.\n\n")
+	b.WriteString("Use this information to understand my environment when helping me.\n")
+
+	r.writeFindings(&b)
+	b.WriteString("\n")
 	
 	// Only include intro category results
 	for _, result := range r.Results {
@@ -237,6 +291,8 @@ func (r *MarkdownReport) GenerateIntro() (string, int, error) {
 			b.WriteString("\n```\n\n")
 		}
 	}
+
+	r.writeOmittedSection(&b)
 	
 	content := b.String()
 	
@@ -249,3 +305,39 @@ func (r *MarkdownReport) GenerateIntro() (string, int, error) {
 	return content, tokenCount, nil
 }
 
+// writeFindings writes the issues found by checks, most serious first, each
+// with its remedy
+func (r *MarkdownReport) writeFindings(b *strings.Builder) {
+	if len(r.Findings) == 0 {
+		return
+	}
+
+	b.WriteString("\n## Findings\n\n")
+	for _, issue := range r.Findings {
+		b.WriteString(fmt.Sprintf("- **%s** (%s): %s\n", issue.Severity, issue.Task, issue.Message))
+		if issue.Hint != "" {
+			b.WriteString(fmt.Sprintf("  - Fix: %s\n", issue.Hint))
+		}
+	}
+}
+
+// writeTable writes records as a Markdown table with the given columns
+func writeTable(b *strings.Builder, columns []string, records []probe.Record) {
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString(strings.Repeat("|---", len(columns)) + "|\n")
+	for _, record := range records {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			if value, ok := record[column]; ok && value != nil {
+				cells[i] = tableCell(fmt.Sprint(value))
+			}
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+}
+
+// tableCell escapes a value for a Markdown table cell
+func tableCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,98 @@
+package report
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+// Format is the format of a report
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+	FormatJSONL    Format = "jsonl" // one JSON object per task
+)
+
+// ParseFormat parses a report format: markdown, json or jsonl
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatMarkdown, FormatJSON, FormatJSONL:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown report format %q (want markdown, json or jsonl)", s)
+}
+
+// Mode is the kind of report
+type Mode string
+
+const (
+	ModeFull     Mode = "full"
+	ModeMinified Mode = "minified" // fewer tokens: no empty output, shorter headers
+	ModeIntro    Mode = "intro"    // a short summary of the system for a chat; Markdown only
+)
+
+// Options select the report Render produces
+type Options struct {
+	Format    Format        // FormatMarkdown if empty
+	Mode      Mode          // ModeFull if empty
+	Generated time.Time     // when the report was generated; now if zero
+	Findings  []probe.Issue // issues listed at the top
+	MaxTokens int           // token budget of a Markdown report; 0 for no limit
+}
+
+// Render renders results from the platform p as a report and returns it
+// with its token count. It is how the command, the server and the MCP tools
+// all render reports.
+func Render(p platform.Platform, results []probe.TaskResult, opts Options) (string, int, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatMarkdown
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = ModeFull
+	}
+	switch mode {
+	case ModeFull, ModeMinified, ModeIntro:
+	default:
+		return "", 0, fmt.Errorf("unknown report mode %q (want full, minified or intro)", mode)
+	}
+	generated := opts.Generated
+	if generated.IsZero() {
+		generated = time.Now()
+	}
+
+	switch format {
+	case FormatJSON, FormatJSONL:
+		rep := NewJSONReport(p, results)
+		rep.Generated = generated
+		rep.Findings = opts.Findings
+		if format == FormatJSONL {
+			return rep.GenerateLines()
+		}
+		if mode == ModeMinified {
+			return rep.GenerateMinified()
+		}
+		return rep.Generate()
+	case FormatMarkdown:
+	default:
+		return "", 0, fmt.Errorf("unknown report format %q (want markdown, json or jsonl)", format)
+	}
+
+	rep := NewMarkdownReport(p, results)
+	rep.Generated = generated
+	rep.MaxTokens = opts.MaxTokens
+	rep.Findings = opts.Findings
+	switch mode {
+	case ModeIntro:
+		return rep.GenerateIntro()
+	case ModeMinified:
+		return rep.GenerateMinified()
+	default:
+		return rep.Generate()
+	}
+}
@@ -0,0 +1,544 @@
+// Package server serves probes and reports over HTTP, for tools that drive
+// sysprobe without running the binary for every question.
+//
+// Every request needs an `Authorization: Bearer <token>` header. Runs are
+// kept in memory until newer ones push them out:
+//
+//	GET    /v1/tasks              the loaded tasks and whether they can run
+//	POST   /v1/runs               run a selection of tasks
+//	GET    /v1/runs/{id}          state and progress of a run
+//	GET    /v1/runs/{id}/events   progress as server-sent events
+//	GET    /v1/runs/{id}/report   the report of a finished run
+//	DELETE /v1/runs/{id}          cancel a run
+package server
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+const (
+	// maxRuns is how many runs are kept; the oldest finished ones are
+	// forgotten first
+	maxRuns = 32
+
+	// maxActive is how many runs may be in progress at once
+	maxActive = 4
+
+	// maxRequestBytes bounds the body of a run request
+	maxRequestBytes = 1 << 20
+)
+
+// Report modes accepted by the report endpoint
+const (
+	ModeFull     = sysprobe.ModeFull
+	ModeMinified = sysprobe.ModeMinified
+	ModeIntro    = sysprobe.ModeIntro
+)
+
+// Report formats accepted by the report endpoint
+const (
+	FormatMarkdown = sysprobe.FormatMarkdown
+	FormatJSON     = sysprobe.FormatJSON
+	FormatJSONL    = sysprobe.FormatJSONL
+)
+
+// Types of run events
+const (
+	EventStart    = "start"    // a task started
+	EventDone     = "done"     // a task finished, was skipped or cancelled
+	EventFinished = "finished" // the run is over and its report can be fetched
+)
+
+// Server runs the tasks of the loaded manifests on request. Only tasks in
+// Probes can be run; each goes through sysprobe.Run, so results are
+// redacted and privileged tasks are skipped unless the server runs as root.
+type Server struct {
+	Probes  sysprobe.Probes
+	Options []sysprobe.Option // for every run, e.g. sysprobe.WithWorkers, WithDeadline or WithRedaction
+	Token   string            // bearer token every request must carry
+
+	mu   sync.Mutex
+	runs []*run // oldest first
+}
+
+// TaskInfo describes a loaded task
+type TaskInfo struct {
+	Name      string   `json:"name"`
+	Category  string   `json:"category"`
+	Tags      []string `json:"tags,omitempty"`
+	Requires  []string `json:"requires,omitempty"`
+	Privilege string   `json:"privilege,omitempty"`
+	Runnable  bool     `json:"runnable"`
+	Reason    string   `json:"reason,omitempty"` // why the task cannot run
+}
+
+// RunRequest selects the tasks of a run by exact name or by category. An
+// empty request runs every task. Tasks the selected ones depend on are
+// added.
+type RunRequest struct {
+	Tasks      []string `json:"tasks,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// RunStatus is the state of a run
+type RunStatus struct {
+	ID       string     `json:"id"`
+	State    string     `json:"state"` // running or finished
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Total    int        `json:"total"`
+	Done     int        `json:"done"`
+}
+
+// Event reports the progress of a run
+type Event struct {
+	Type       string           `json:"type"`
+	Task       string           `json:"task,omitempty"`
+	Status     *sysprobe.Status `json:"status,omitempty"`
+	DurationMS float64          `json:"duration_ms,omitempty"`
+	Done       int              `json:"done"`
+	Total      int              `json:"total"`
+}
+
+// run is a set of tasks started by a request
+type run struct {
+	id      string
+	total   int
+	started time.Time
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	events   []Event
+	changed  chan struct{} // closed and replaced when an event is added
+	done     int
+	finished time.Time
+	results  []sysprobe.Result // redacted, once finished
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/tasks", s.listTasks)
+	mux.HandleFunc("POST /v1/runs", s.startRun)
+	mux.HandleFunc("GET /v1/runs/{id}", s.runStatus)
+	mux.HandleFunc("GET /v1/runs/{id}/events", s.runEvents)
+	mux.HandleFunc("GET /v1/runs/{id}/report", s.runReport)
+	mux.HandleFunc("DELETE /v1/runs/{id}", s.cancelRun)
+	return s.authorize(mux)
+}
+
+// Close cancels the runs in progress
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		r.cancel()
+	}
+}
+
+// authorize rejects requests without the server's bearer token
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sysprobe"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// listTasks lists the loaded tasks, optionally only those in the
+// categories or with the tags given as query parameters
+func (s *Server) listTasks(w http.ResponseWriter, req *http.Request) {
+	sel := sysprobe.Selector{
+		Categories: queryList(req, "category"),
+		Tags:       queryList(req, "tag"),
+	}
+	tasks, err := sel.Filter(s.Probes.Tasks)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	infos := make([]TaskInfo, 0, len(tasks))
+	for _, task := range tasks {
+		ok, reason := sysprobe.CanRun(task, sysprobe.WithPlatform(s.Probes.Platform))
+		infos = append(infos, TaskInfo{
+			Name:      task.Name,
+			Category:  task.Category,
+			Tags:      task.Tags,
+			Requires:  task.Requires,
+			Privilege: task.Privilege,
+			Runnable:  ok,
+			Reason:    reason,
+		})
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// startRun starts running the requested tasks and returns the new run
+func (s *Server) startRun(w http.ResponseWriter, req *http.Request) {
+	var request RunRequest
+	body := http.MaxBytesReader(w, req.Body, maxRequestBytes)
+	if err := json.NewDecoder(body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	tasks, err := s.selectTasks(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r, err := s.start(tasks)
+	if err != nil {
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/v1/runs/"+r.id)
+	writeJSON(w, http.StatusAccepted, r.status())
+}
+
+// selectTasks returns the tasks a request names, with their dependencies.
+// Names must match a loaded task exactly.
+func (s *Server) selectTasks(request RunRequest) ([]sysprobe.Task, error) {
+	if len(request.Tasks) == 0 && len(request.Categories) == 0 {
+		return s.Probes.Tasks, nil
+	}
+
+	for _, name := range request.Tasks {
+		if !slices.ContainsFunc(s.Probes.Tasks, func(t sysprobe.Task) bool { return t.Name == name }) {
+			return nil, fmt.Errorf("unknown task %q", name)
+		}
+	}
+	for _, category := range request.Categories {
+		if !slices.ContainsFunc(s.Probes.Tasks, func(t sysprobe.Task) bool { return t.Category == category }) {
+			return nil, fmt.Errorf("unknown category %q", category)
+		}
+	}
+
+	var selected []sysprobe.Task
+	for _, task := range s.Probes.Tasks {
+		if slices.Contains(request.Tasks, task.Name) || slices.Contains(request.Categories, task.Category) {
+			selected = append(selected, task)
+		}
+	}
+	return sysprobe.AddDependencies(s.Probes.Tasks, selected), nil
+}
+
+// start runs tasks in the background as a new run
+func (s *Server) start(tasks []sysprobe.Task) (*run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := 0
+	for _, r := range s.runs {
+		if !r.isFinished() {
+			active++
+		}
+	}
+	if active >= maxActive {
+		return nil, fmt.Errorf("%d runs are already in progress", active)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &run{
+		id:      newID(),
+		total:   len(tasks),
+		started: time.Now(),
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+	s.runs = append(s.runs, r)
+	s.prune()
+
+	go func() {
+		defer cancel()
+		opts := append([]sysprobe.Option{sysprobe.WithPlatform(s.Probes.Platform)}, s.Options...)
+		for event := range sysprobe.Run(ctx, tasks, opts...) {
+			switch event.Type {
+			case sysprobe.EventStart:
+				r.add(Event{Type: EventStart, Task: event.Task.Name})
+			case sysprobe.EventDone:
+				result := event.Result
+				r.add(Event{
+					Type:       EventDone,
+					Task:       result.Name,
+					Status:     &result.Status,
+					DurationMS: float64(result.Duration) / float64(time.Millisecond),
+				})
+			case sysprobe.EventFinished:
+				if event.Err != nil {
+					log.Printf("run %s: %v", r.id, event.Err)
+				}
+				r.finish(event.Results)
+			}
+		}
+	}()
+	return r, nil
+}
+
+// prune forgets the oldest finished runs beyond maxRuns
+func (s *Server) prune() {
+	for i := 0; len(s.runs) > maxRuns && i < len(s.runs); {
+		if s.runs[i].isFinished() {
+			s.runs = slices.Delete(s.runs, i, i+1)
+			continue
+		}
+		i++
+	}
+}
+
+// lookup returns the run named in the request path, or writes an error
+func (s *Server) lookup(w http.ResponseWriter, req *http.Request) *run {
+	id := req.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		if r.id == id {
+			return r
+		}
+	}
+	writeError(w, http.StatusNotFound, "no run "+id)
+	return nil
+}
+
+// runStatus returns the state of a run
+func (s *Server) runStatus(w http.ResponseWriter, req *http.Request) {
+	if r := s.lookup(w, req); r != nil {
+		writeJSON(w, http.StatusOK, r.status())
+	}
+}
+
+// cancelRun cancels the tasks of a run that are still pending or running.
+// Its report then holds what was collected.
+func (s *Server) cancelRun(w http.ResponseWriter, req *http.Request) {
+	if r := s.lookup(w, req); r != nil {
+		r.cancel()
+		writeJSON(w, http.StatusOK, r.status())
+	}
+}
+
+// runEvents streams the events of a run as server-sent events until the
+// run finishes or the client goes away. Each event's id is its number in
+// the run, so a client that reconnects with Last-Event-ID resumes after the
+// last event it received; otherwise the stream starts from the first one.
+func (s *Server) runEvents(w http.ResponseWriter, req *http.Request) {
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	next := 0
+	if value := req.Header.Get("Last-Event-ID"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > r.count() {
+			writeError(w, http.StatusBadRequest, "invalid Last-Event-ID "+strconv.Quote(value))
+			return
+		}
+		next = n
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	for {
+		events, changed, last := r.since(next)
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			next++
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, event.Type, data)
+		}
+		if err := rc.Flush(); err != nil || last {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// runReport renders the report of a finished run. The query parameters
+// format (markdown, json or jsonl), mode (full, minified or intro) and
+// max_tokens select it as the flags of the same names do.
+func (s *Server) runReport(w http.ResponseWriter, req *http.Request) {
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+	results, ok := r.finishedResults()
+	if !ok {
+		writeError(w, http.StatusConflict, "run "+r.id+" is still in progress")
+		return
+	}
+
+	query := req.URL.Query()
+	format := cmp.Or(sysprobe.Format(query.Get("format")), FormatMarkdown)
+	mode := cmp.Or(sysprobe.Mode(query.Get("mode")), ModeFull)
+	maxTokens := 0
+	if value := query.Get("max_tokens"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid max_tokens "+strconv.Quote(value))
+			return
+		}
+		maxTokens = n
+	}
+
+	content, tokenCount, err := s.Render(results, r.started, mode, format, maxTokens)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch format {
+	case FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+	case FormatJSONL:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	}
+	w.Header().Set("X-Token-Count", strconv.Itoa(tokenCount))
+	fmt.Fprint(w, content)
+}
+
+// Render renders results collected at the generated time, with the
+// findings of the server's checks
+func (s *Server) Render(results []sysprobe.Result, generated time.Time, mode sysprobe.Mode, format sysprobe.Format, maxTokens int) (string, int, error) {
+	findings, err := sysprobe.EvaluateChecks(s.Probes.Checks, results)
+	if err != nil {
+		log.Printf("checks: %v", err)
+	}
+	return sysprobe.Render(results, format,
+		sysprobe.WithPlatform(s.Probes.Platform),
+		sysprobe.WithMode(mode),
+		sysprobe.WithGenerated(generated),
+		sysprobe.WithFindings(findings),
+		sysprobe.WithMaxTokens(maxTokens))
+}
+
+// add records an event and wakes the clients waiting for it
+func (r *run) add(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if event.Type == EventDone {
+		r.done++
+	}
+	event.Done, event.Total = r.done, r.total
+	r.events = append(r.events, event)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// finish keeps the results and adds the final event
+func (r *run) finish(results []sysprobe.Result) {
+	r.mu.Lock()
+	r.results = results
+	r.finished = time.Now()
+	r.mu.Unlock()
+	r.add(Event{Type: EventFinished})
+}
+
+// since returns the events from index next on, a channel closed when more
+// are added, and whether the last of them ends the run
+func (r *run) since(next int) ([]Event, <-chan struct{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := slices.Clone(r.events[next:])
+	last := len(r.events) > 0 && r.events[len(r.events)-1].Type == EventFinished
+	return events, r.changed, last
+}
+
+// count returns the number of events so far
+func (r *run) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+// isFinished reports whether the run is over
+func (r *run) isFinished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.finished.IsZero()
+}
+
+// finishedResults returns the results of a finished run
+func (r *run) finishedResults() ([]sysprobe.Result, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.results, !r.finished.IsZero()
+}
+
+// status returns the state of the run
+func (r *run) status() RunStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := RunStatus{ID: r.id, State: "running", Started: r.started, Total: r.total, Done: r.done}
+	if !r.finished.IsZero() {
+		finished := r.finished
+		status.State, status.Finished = "finished", &finished
+	}
+	return status
+}
+
+// newID returns a random run ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// queryList returns the comma-separated values of a repeatable query
+// parameter
+func queryList(req *http.Request, key string) []string {
+	var values []string
+	for _, value := range req.URL.Query()[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// writeJSON writes v as the JSON body of a response
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response as {"error": msg}
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
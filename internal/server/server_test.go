@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+)
+
+var (
+	diskUsage = sysprobe.Task{Name: "Disk Usage", Command: "echo '/dev/sda2 97% /'", Category: "storage"}
+	gateway   = sysprobe.Task{Name: "Gateway", Command: "echo 'default via 91.198.174.192 dev eth0'", Category: "network"}
+	smart     = sysprobe.Task{Name: "SMART Status", Command: "smartctl -H /dev/sda", Category: "storage", Privilege: "sudo"}
+	// fsScan runs until it is cancelled
+	fsScan = sysprobe.Task{Name: "Filesystem Scan", Command: "tail -f /dev/null", Category: "storage"}
+
+	rootFull = sysprobe.Check{Name: "root-full", Task: "Disk Usage", If: `contains("97%")`, Severity: probe.IssueWarning, Message: "/ is almost full"}
+)
+
+// sseEvent is an event read from an event stream, with its id
+type sseEvent struct {
+	id string
+	Event
+}
+
+// readEvents reads events from an event stream until it ends or, if stop
+// is set, stop returns true for the events so far
+func readEvents(t *testing.T, stream io.Reader, stop func(events []sseEvent) bool) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var id string
+	scanner := bufio.NewScanner(stream)
+	for (stop == nil || !stop(events)) && scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "id: "); ok {
+			id = value
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			event := sseEvent{id: id}
+			if err := json.Unmarshal([]byte(data), &event.Event); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// client talks to a test server with its bearer token
+type client struct {
+	t   *testing.T
+	url string
+}
+
+// newClient starts a server for tasks and checks and returns a client of it
+func newClient(t *testing.T, tasks []sysprobe.Task, checks ...sysprobe.Check) *client {
+	srv := &Server{
+		Probes: sysprobe.Probes{
+			Platform: sysprobe.Platform{OS: "linux", DistroID: "test"},
+			Tasks:    tasks,
+			Checks:   checks,
+		},
+		Options: []sysprobe.Option{sysprobe.WithWorkers(2)},
+		Token:   "s3cret",
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(srv.Close)
+	return &client{t: t, url: ts.URL}
+}
+
+// do sends a request with the token and the given header name and value
+// pairs
+func (c *client) do(method, path, body string, header ...string) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.url+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer s3cret")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// start starts a run and returns its status
+func (c *client) start(request string) RunStatus {
+	c.t.Helper()
+	resp := c.do("POST", "/v1/runs", request)
+	var status RunStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	if resp.StatusCode != http.StatusAccepted {
+		c.t.Fatalf("start run: %s", resp.Status)
+	}
+	return status
+}
+
+// events reads the event stream of a run until it ends
+func (c *client) events(id string, header ...string) []sseEvent {
+	c.t.Helper()
+	return readEvents(c.t, c.do("GET", "/v1/runs/"+id+"/events", "", header...).Body, nil)
+}
+
+func TestServer(t *testing.T) {
+	t.Run("auth", func(t *testing.T) {
+		c := newClient(t, []sysprobe.Task{diskUsage, gateway, smart})
+		for _, header := range []string{"", "Bearer nope", "Basic czNjcmV0"} {
+			req, _ := http.NewRequest("GET", c.url+"/v1/tasks", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("Authorization %q: %s", header, resp.Status)
+			}
+		}
+
+		var tasks []TaskInfo
+		json.NewDecoder(c.do("GET", "/v1/tasks?category=storage", "").Body).Decode(&tasks)
+		if len(tasks) != 2 || tasks[1].Name != "SMART Status" || tasks[1].Runnable || tasks[1].Reason == "" {
+			t.Errorf("tasks in storage: %+v", tasks)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		c := newClient(t, []sysprobe.Task{diskUsage, gateway, smart})
+		status := c.start(`{"categories": ["storage"], "tasks": ["Gateway"]}`)
+		if status.Total != 3 {
+			t.Fatalf("started %+v", status)
+		}
+		all := c.events(status.ID)
+		if last := all[len(all)-1]; last.Type != EventFinished || last.Done != 3 || last.id != strconv.Itoa(len(all)) {
+			t.Fatalf("events: %+v", all)
+		}
+
+		// Each resumed stream is the rest of the full one
+		for _, after := range []int{0, 1, len(all) - 1, len(all)} {
+			resumed := c.events(status.ID, "Last-Event-ID", strconv.Itoa(after))
+			if len(resumed) != len(all)-after {
+				t.Errorf("after %d: %d events, want %d", after, len(resumed), len(all)-after)
+				continue
+			}
+			for i, event := range resumed {
+				if want := all[after+i]; event.id != want.id || event.Type != want.Type || event.Task != want.Task {
+					t.Errorf("after %d: event %+v, want %+v", after, event, want)
+				}
+			}
+		}
+
+		for _, id := range []string{strconv.Itoa(len(all) + 1), "-1", "last"} {
+			if resp := c.do("GET", "/v1/runs/"+status.ID+"/events", "", "Last-Event-ID", id); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Last-Event-ID %s: %s", id, resp.Status)
+			}
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		c := newClient(t, []sysprobe.Task{diskUsage, fsScan})
+		status := c.start(`{}`)
+
+		// Wait for the quick task while the scan keeps running
+		first := c.do("GET", "/v1/runs/"+status.ID+"/events", "")
+		seen := readEvents(t, first.Body, func(events []sseEvent) bool {
+			return len(events) > 0 && events[len(events)-1].Done == 1
+		})
+		first.Body.Close()
+		if resp := c.do("GET", "/v1/runs/"+status.ID+"/report", ""); resp.StatusCode != http.StatusConflict {
+			t.Errorf("report of a run in progress: %s", resp.Status)
+		}
+
+		if resp := c.do("DELETE", "/v1/runs/"+status.ID, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("cancel: %s", resp.Status)
+		}
+		rest := c.events(status.ID, "Last-Event-ID", seen[len(seen)-1].id)
+		var scan *sysprobe.Status
+		for _, event := range rest {
+			if event.Type == EventDone && event.Task == fsScan.Name {
+				scan = event.Status
+			}
+		}
+		if scan == nil || *scan != sysprobe.StatusCancelled || rest[len(rest)-1].Type != EventFinished {
+			t.Errorf("events after cancelling: %+v", rest)
+		}
+
+		var after RunStatus
+		json.NewDecoder(c.do("GET", "/v1/runs/"+status.ID, "").Body).Decode(&after)
+		if after.State != "finished" || after.Done != 2 {
+			t.Errorf("status after cancelling: %+v", after)
+		}
+		if resp := c.do("DELETE", "/v1/runs/nope", ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("unknown run: %s", resp.Status)
+		}
+	})
+
+	t.Run("report", func(t *testing.T) {
+		c := newClient(t, []sysprobe.Task{diskUsage, gateway, smart}, rootFull)
+		status := c.start(`{}`)
+		c.events(status.ID)
+		path := "/v1/runs/" + status.ID + "/report"
+
+		var doc sysprobe.Document
+		resp := c.do("GET", path+"?format=json", "")
+		json.NewDecoder(resp.Body).Decode(&doc)
+		if resp.Header.Get("Content-Type") != "application/json" || doc.Summary.Success != 2 || doc.Summary.Skipped != 1 ||
+			len(doc.Findings) != 1 || doc.Findings[0].Message != rootFull.Message {
+			t.Errorf("report summary %+v, findings %+v", doc.Summary, doc.Findings)
+		}
+
+		resp = c.do("GET", path+"?mode=minified", "")
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens, err := strconv.Atoi(resp.Header.Get("X-Token-Count")); err != nil || tokens == 0 || !strings.HasPrefix(string(body), "#") {
+			t.Errorf("X-Token-Count %q, report:\n%s", resp.Header.Get("X-Token-Count"), body)
+		}
+
+		for _, query := range []string{"mode=huge", "format=yaml", "max_tokens=-1", "max_tokens=many"} {
+			if resp := c.do("GET", path+"?"+query, ""); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: %s", query, resp.Status)
+			}
+		}
+	})
+}
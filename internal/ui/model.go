@@ -87,7 +87,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q":
-			m.quitting = true
+			// Closing after the report is written is not an interruption
+			m.quitting = !m.waitingInput
 			return m, tea.Quit
 		case "enter", " ":
 			// Exit on enter/space if waiting for input
@@ -140,7 +141,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 // View renders the UI
 func (m Model) View() string {
 	if m.quitting {
-		return "\n  Interrupted. Partial results may be available.\n\n"
+		return "\n  Interrupted. Writing a partial report...\n\n"
 	}
 
 	var b strings.Builder
@@ -255,6 +256,10 @@ func (m Model) renderTaskRow(task probe.TaskResult) string {
 		status = StatusSkipped.String()
 	case probe.StatusFailed:
 		status = StatusFailed.String()
+	case probe.StatusTimedOut:
+		status = StatusTimedOut.String()
+	case probe.StatusCancelled:
+		status = StatusCancelled.String()
 	}
 
 	duration := ""
@@ -50,6 +50,14 @@ var (
 			Foreground(Error).
 			SetString("✗ Failed")
 
+	StatusTimedOut = lipgloss.NewStyle().
+			Foreground(Error).
+			SetString("⏱ Timed Out")
+
+	StatusCancelled = lipgloss.NewStyle().
+			Foreground(Muted).
+			SetString("■ Cancelled")
+
 	// Box styles
 	BoxStyle = lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
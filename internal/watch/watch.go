@@ -0,0 +1,151 @@
+package watch
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Triggers that cause a snapshot
+const (
+	TriggerStart    = "start"
+	TriggerInterval = "interval"
+	TriggerResume   = "resume"
+	TriggerNetwork  = "network"
+)
+
+const (
+	DefaultPollInterval = 5 * time.Second
+	DefaultSettle       = 10 * time.Second
+
+	// resumeThreshold is how far the wall clock must run ahead of the
+	// monotonic clock between two polls to count as a resume from suspend
+	resumeThreshold = 30 * time.Second
+)
+
+// Event asks for a snapshot
+type Event struct {
+	Trigger string
+	Time    time.Time
+}
+
+// Watcher emits events on a fixed interval and, optionally, after a resume
+// from suspend or a change of network configuration
+type Watcher struct {
+	Interval time.Duration // 0 disables periodic snapshots
+	Resume   bool
+	Network  bool
+
+	// PollInterval is how often resume and network changes are checked
+	PollInterval time.Duration
+	// Settle is how long the network must stay unchanged before an event,
+	// so that a reconnect produces a single snapshot
+	Settle time.Duration
+}
+
+// New creates a watcher with all triggers enabled
+func New(interval time.Duration) *Watcher {
+	return &Watcher{
+		Interval:     interval,
+		Resume:       true,
+		Network:      true,
+		PollInterval: DefaultPollInterval,
+		Settle:       DefaultSettle,
+	}
+}
+
+// Run sends events until ctx is done. Any event restarts the interval.
+func (w *Watcher) Run(ctx context.Context, events chan<- Event) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	// The monotonic clock stops during suspend while the wall clock does not
+	last := time.Now()
+	nextDue := last.Add(w.Interval)
+
+	network := networkState()
+	var networkChanged time.Time
+
+	send := func(trigger string, now time.Time) bool {
+		select {
+		case events <- Event{Trigger: trigger, Time: now}:
+		case <-ctx.Done():
+			return false
+		}
+		// Time spent by the receiver must not look like a suspend
+		last = time.Now()
+		nextDue = last.Add(w.Interval)
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		wallElapsed := now.Round(0).Sub(last.Round(0))
+		monoElapsed := now.Sub(last)
+		last = now
+
+		if w.Resume && wallElapsed-monoElapsed > resumeThreshold {
+			if !send(TriggerResume, now) {
+				return
+			}
+			continue
+		}
+
+		if w.Network {
+			if state := networkState(); state != network {
+				network = state
+				networkChanged = now
+			}
+			if !networkChanged.IsZero() && now.Sub(networkChanged) >= w.Settle {
+				networkChanged = time.Time{}
+				if !send(TriggerNetwork, now) {
+					return
+				}
+				continue
+			}
+		}
+
+		if w.Interval > 0 && !now.Before(nextDue) {
+			if !send(TriggerInterval, now) {
+				return
+			}
+		}
+	}
+}
+
+// networkState summarizes the interfaces that are up, whether they have a
+// link, and their addresses
+func networkState() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		var list []string
+		for _, addr := range addrs {
+			list = append(list, addr.String())
+		}
+		sort.Strings(list)
+		link := "down"
+		if iface.Flags&net.FlagRunning != 0 {
+			link = "up"
+		}
+		parts = append(parts, iface.Name+"/"+link+"="+strings.Join(list, ","))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
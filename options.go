@@ -0,0 +1,142 @@
+package sysprobe
+
+import (
+	"time"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+)
+
+// Option configures LoadProbes, Run or Render. Each function documents the
+// options it takes and ignores the others, so one set can be shared.
+type Option func(*config)
+
+// config is the combined effect of options
+type config struct {
+	platform  *Platform
+	sources   []Source
+	probesDir string
+	selector  Selector
+
+	workers   int
+	timeout   time.Duration
+	deadline  time.Duration
+	redaction RedactLevel
+	escalator *Escalator
+	recorder  *Recorder
+	keepBytes int
+	replay    *Fixture
+
+	mode      Mode
+	findings  []Issue
+	generated time.Time
+	maxTokens int
+}
+
+// newConfig applies options over the defaults
+func newConfig(opts []Option) config {
+	cfg := config{
+		workers:   DefaultWorkers,
+		redaction: RedactStandard,
+		mode:      ModeFull,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// detectPlatform returns the configured platform or the current one
+func (c config) detectPlatform() Platform {
+	if c.platform != nil {
+		return *c.platform
+	}
+	return platform.Detect()
+}
+
+// WithPlatform loads manifests for, runs tasks as on, or renders reports of
+// p instead of the current platform
+func WithPlatform(p Platform) Option {
+	return func(c *config) { c.platform = &p }
+}
+
+// WithSources loads manifests from sources, later ones taking precedence,
+// instead of DefaultSources
+func WithSources(sources ...Source) Option {
+	return func(c *config) { c.sources = sources }
+}
+
+// WithProbesDir adds a directory of manifests to DefaultSources, with the
+// highest precedence
+func WithProbesDir(dir string) Option {
+	return func(c *config) { c.probesDir = dir }
+}
+
+// WithSelector loads only the selected tasks
+func WithSelector(s Selector) Option {
+	return func(c *config) { c.selector = s }
+}
+
+// WithWorkers sets how many tasks run at once
+func WithWorkers(n int) Option {
+	return func(c *config) { c.workers = n }
+}
+
+// WithTimeout sets the timeout of tasks that do not set their own
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) { c.timeout = d }
+}
+
+// WithDeadline cancels the tasks still pending or running after d
+func WithDeadline(d time.Duration) Option {
+	return func(c *config) { c.deadline = d }
+}
+
+// WithRedaction sets how results are redacted; the default is
+// RedactStandard
+func WithRedaction(level RedactLevel) Option {
+	return func(c *config) { c.redaction = level }
+}
+
+// WithEscalator runs privileged tasks as root through e, started with
+// StartEscalation
+func WithEscalator(e *Escalator) Option {
+	return func(c *config) { c.escalator = e }
+}
+
+// WithRecorder keeps the output of every command in r, created with
+// NewRecorder and redacted like the results
+func WithRecorder(r *Recorder) Option {
+	return func(c *config) { c.recorder = r }
+}
+
+// WithKeepBytes keeps up to n bytes of each output stream while a command
+// runs, for the recorder, even where the task keeps less
+func WithKeepBytes(n int) Option {
+	return func(c *config) { c.keepBytes = n }
+}
+
+// WithReplay takes the outcome of every task from a fixture, read with
+// LoadFixture or ParseFixture, instead of running it
+func WithReplay(f *Fixture) Option {
+	return func(c *config) { c.replay = f }
+}
+
+// WithMode sets the kind of report; the default is ModeFull
+func WithMode(m Mode) Option {
+	return func(c *config) { c.mode = m }
+}
+
+// WithFindings puts issues found by EvaluateChecks at the top of the report
+func WithFindings(issues []Issue) Option {
+	return func(c *config) { c.findings = issues }
+}
+
+// WithGenerated dates the report; the default is when it is rendered
+func WithGenerated(t time.Time) Option {
+	return func(c *config) { c.generated = t }
+}
+
+// WithMaxTokens fits a Markdown report into n tokens; 0 for no limit
+func WithMaxTokens(n int) Option {
+	return func(c *config) { c.maxTokens = n }
+}
@@ -0,0 +1,76 @@
+package sysprobe
+
+import (
+	"io"
+
+	"github.com/pkrzeminski/sysprobe/internal/report"
+)
+
+// Format is the format of a report
+type Format = report.Format
+
+const (
+	FormatMarkdown = report.FormatMarkdown
+	FormatJSON     = report.FormatJSON
+	FormatJSONL    = report.FormatJSONL // one JSON object per task
+)
+
+// ParseFormat parses a report format: markdown, json or jsonl
+func ParseFormat(s string) (Format, error) {
+	return report.ParseFormat(s)
+}
+
+// Mode is the kind of report
+type Mode = report.Mode
+
+const (
+	ModeFull     = report.ModeFull
+	ModeMinified = report.ModeMinified // fewer tokens: no empty output, shorter headers
+	ModeIntro    = report.ModeIntro    // a short summary of the system for a chat; Markdown only
+)
+
+// Render renders results as a report and returns it with its token count.
+// It takes WithPlatform, WithMode, WithFindings, WithGenerated and
+// WithMaxTokens.
+func Render(results []Result, format Format, opts ...Option) (string, int, error) {
+	cfg := newConfig(opts)
+	return report.Render(cfg.detectPlatform(), results, report.Options{
+		Format:    format,
+		Mode:      cfg.mode,
+		Generated: cfg.generated,
+		Findings:  cfg.findings,
+		MaxTokens: cfg.maxTokens,
+	})
+}
+
+// Document is a report in the JSON format, as saved in history snapshots
+type Document = report.JSONDocument
+
+// NewDocument returns results as a JSON report document. It takes
+// WithPlatform and WithGenerated.
+func NewDocument(results []Result, opts ...Option) Document {
+	cfg := newConfig(opts)
+	rep := report.NewJSONReport(cfg.detectPlatform(), results)
+	if !cfg.generated.IsZero() {
+		rep.Generated = cfg.generated
+	}
+	return rep.Document()
+}
+
+// ReadDocument reads a report rendered as json or jsonl
+func ReadDocument(r io.Reader) (Document, error) {
+	return report.ReadJSON(r)
+}
+
+// DefaultDiffContext is how many unchanged lines Diff shows around each
+// change by default
+const DefaultDiffContext = report.DefaultDiffContext
+
+// Diff renders what changed from old to new as a Markdown report, with
+// context unchanged lines around each change, and returns it with its
+// token count
+func Diff(old, new Document, context int) (string, int, error) {
+	rep := report.NewDiffReport(old, new)
+	rep.Context = context
+	return rep.Generate()
+}
@@ -0,0 +1,108 @@
+package sysprobe
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+	"github.com/pkrzeminski/sysprobe/internal/redact"
+)
+
+// EventType identifies an event of a run
+type EventType string
+
+const (
+	EventStart    EventType = "start"    // a task started
+	EventDone     EventType = "done"     // a task finished or was skipped
+	EventFinished EventType = "finished" // the run is over; always the last event
+)
+
+// Event reports the progress of a run
+type Event struct {
+	Type    EventType
+	Task    Task     // for EventStart
+	Result  Result   // for EventDone
+	Results []Result // every result in task order, for EventFinished
+	Err     error    // why the run could not start, for EventFinished
+}
+
+// Run runs tasks in the background and returns their events. Tasks start
+// once the tasks they depend on have finished; privileged tasks are skipped
+// unless running as root or WithEscalator is given. Results are redacted
+// and sent in task order, so placeholders are numbered the same way however
+// the tasks finish; a slow task holds back the results after it. Once ctx
+// is done the remaining tasks are cancelled.
+// The channel is buffered for every event of the run, so it need not be
+// drained. Run takes WithPlatform, WithWorkers, WithTimeout, WithDeadline,
+// WithRedaction, WithEscalator, WithRecorder, WithKeepBytes and WithReplay.
+func Run(ctx context.Context, tasks []Task, opts ...Option) <-chan Event {
+	cfg := newConfig(opts)
+	events := make(chan Event, 2*len(tasks)+1)
+
+	// Local values are not looked for in output recorded elsewhere
+	redactor := redact.New(cfg.redaction)
+	if cfg.replay != nil {
+		redactor = redact.NewEmpty(cfg.redaction)
+	}
+	if err := redactor.AddTaskRules(tasks); err != nil {
+		events <- Event{Type: EventFinished, Err: err}
+		close(events)
+		return events
+	}
+
+	runner := probe.NewRunner(cfg.detectPlatform())
+	if cfg.timeout > 0 {
+		runner.Timeout = cfg.timeout
+	}
+	runner.Escalator = cfg.escalator
+	runner.Replay = cfg.replay
+	runner.KeepBytes = cfg.keepBytes
+	if cfg.recorder != nil {
+		cfg.recorder.Redact = redactor.Text
+		runner.Recorder = cfg.recorder
+	}
+
+	go func() {
+		defer close(events)
+		if cfg.deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, cfg.deadline, probe.ErrDeadline)
+			defer cancel()
+		}
+
+		pool := probe.NewPool(runner, cfg.workers)
+		pool.OnStart = func(task Task) {
+			events <- Event{Type: EventStart, Task: task}
+		}
+
+		// Finished results wait for those of the tasks before them
+		var mu sync.Mutex
+		finished := make([]*Result, len(tasks))
+		results := make([]Result, 0, len(tasks))
+		pool.OnDone = func(i int, result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			finished[i] = &result
+			for len(results) < len(tasks) && finished[len(results)] != nil {
+				redacted := redactor.Results([]Result{*finished[len(results)]})[0]
+				results = append(results, redacted)
+				events <- Event{Type: EventDone, Result: redacted}
+			}
+		}
+		pool.Run(ctx, tasks)
+		events <- Event{Type: EventFinished, Results: results}
+	}()
+	return events
+}
+
+// Redact returns copies of results redacted with the rules of tasks, as
+// Run would send them. Results redacted in one call share placeholders.
+// It takes WithRedaction.
+func Redact(results []Result, tasks []Task, opts ...Option) ([]Result, error) {
+	cfg := newConfig(opts)
+	redactor := redact.New(cfg.redaction)
+	if err := redactor.AddTaskRules(tasks); err != nil {
+		return nil, err
+	}
+	return redactor.Results(results), nil
+}
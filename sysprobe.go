@@ -0,0 +1,188 @@
+// Package sysprobe collects diagnostics of a Linux system and renders them
+// as reports sized for LLMs. It is what the sysprobe command is built on,
+// for Go programs that want to run the probes themselves:
+//
+//	probes, err := sysprobe.LoadProbes(sysprobe.WithSelector(sysprobe.Selector{Categories: []string{"audio"}}))
+//	if err != nil {
+//		return err
+//	}
+//	var results []sysprobe.Result
+//	for event := range sysprobe.Run(ctx, probes.Tasks, sysprobe.WithWorkers(4)) {
+//		if event.Type == sysprobe.EventFinished {
+//			results = event.Results
+//		}
+//	}
+//	findings, _ := sysprobe.EvaluateChecks(probes.Checks, results)
+//	report, tokens, err := sysprobe.Render(results, sysprobe.FormatMarkdown,
+//		sysprobe.WithPlatform(probes.Platform), sysprobe.WithFindings(findings), sysprobe.WithMaxTokens(4000))
+package sysprobe
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/pkrzeminski/sysprobe/internal/platform"
+	"github.com/pkrzeminski/sysprobe/internal/probe"
+	"github.com/pkrzeminski/sysprobe/internal/redact"
+)
+
+// Types shared with the command and its manifests
+type (
+	Platform    = platform.Platform
+	Task        = probe.Task
+	Result      = probe.TaskResult
+	Status      = probe.Status
+	Record      = probe.Record
+	Check       = probe.Check
+	Issue       = probe.Issue
+	Selector    = probe.Selector
+	Fixture     = probe.Fixture
+	Recorder    = probe.Recorder
+	Escalator   = probe.Escalator
+	RedactLevel = redact.Level
+)
+
+// Task statuses
+const (
+	StatusSuccess   = probe.StatusSuccess
+	StatusFailed    = probe.StatusFailed
+	StatusSkipped   = probe.StatusSkipped
+	StatusTimedOut  = probe.StatusTimedOut
+	StatusCancelled = probe.StatusCancelled
+)
+
+// DefaultWorkers is how many tasks run at once without WithWorkers
+const DefaultWorkers = probe.DefaultWorkers
+
+// Redaction levels
+const (
+	RedactOff      = redact.Off
+	RedactStandard = redact.Standard
+	RedactStrict   = redact.Strict
+)
+
+// Source is a filesystem of manifests
+type Source struct {
+	Name string // where the manifests came from, e.g. "embedded" or a directory
+	FS   fs.FS
+}
+
+// Probes are the tasks and checks of the manifests for a platform
+type Probes struct {
+	Platform Platform
+	Tasks    []Task
+	Checks   []Check
+}
+
+// DetectPlatform returns information about the current platform
+func DetectPlatform() Platform {
+	return platform.Detect()
+}
+
+// ParseRedactLevel parses a redaction level: strict, standard or off
+func ParseRedactLevel(s string) (RedactLevel, error) {
+	return redact.ParseLevel(s)
+}
+
+// DefaultSources returns the embedded manifests followed by the user's
+// overlay directories and dir, if set, in increasing order of precedence
+func DefaultSources(dir string) ([]Source, error) {
+	embedded, err := fs.Sub(ProbeFS, "probes")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []Source{{Name: "embedded", FS: embedded}}
+	for _, userDir := range probe.UserProbeDirs() {
+		if info, err := os.Stat(userDir); err == nil && info.IsDir() {
+			sources = append(sources, Source{Name: userDir, FS: os.DirFS(userDir)})
+		}
+	}
+
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+		sources = append(sources, Source{Name: dir, FS: os.DirFS(dir)})
+	}
+
+	return sources, nil
+}
+
+// LoadProbes loads the manifests for the platform and returns the selected
+// tasks, with the tasks they depend on, and every check. It takes
+// WithPlatform, WithSources, WithProbesDir and WithSelector.
+func LoadProbes(opts ...Option) (*Probes, error) {
+	cfg := newConfig(opts)
+	plat := cfg.detectPlatform()
+
+	sources := cfg.sources
+	if sources == nil {
+		var err error
+		sources, err = DefaultSources(cfg.probesDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fss := make([]fs.FS, len(sources))
+	for i, source := range sources {
+		fss[i] = source.FS
+	}
+
+	loader := probe.NewLoader(fss, plat)
+	tasks, err := loader.GetAllTasks()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err = cfg.selector.Filter(tasks)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := loader.GetAllChecks()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Probes{Platform: plat, Tasks: tasks, Checks: checks}, nil
+}
+
+// IntroTasks returns the tasks of the intro report and the tasks they
+// depend on
+func IntroTasks(tasks []Task) []Task {
+	var intro []Task
+	for _, t := range tasks {
+		if t.Category == "intro" {
+			intro = append(intro, t)
+		}
+	}
+	return AddDependencies(tasks, intro)
+}
+
+// AddDependencies returns the selected tasks and the tasks of all they
+// depend on, in the order of all
+func AddDependencies(all, selected []Task) []Task {
+	return probe.WithDependencies(all, selected)
+}
+
+// CanRun reports whether Run would start a task and, if not, why: it may
+// need root, a missing command, other tags or a condition that is false.
+// It takes WithPlatform, WithEscalator and WithReplay.
+func CanRun(task Task, opts ...Option) (bool, string) {
+	cfg := newConfig(opts)
+	runner := probe.NewRunner(cfg.detectPlatform())
+	runner.Escalator = cfg.escalator
+	runner.Replay = cfg.replay
+	return runner.CanRun(task)
+}
+
+// EvaluateChecks returns the issues checks find in results, most severe
+// first. Checks that cannot be evaluated are reported in the error; the
+// issues of the others are still returned.
+func EvaluateChecks(checks []Check, results []Result) ([]Issue, error) {
+	return probe.EvaluateChecks(checks, results)
+}
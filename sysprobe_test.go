@@ -0,0 +1,244 @@
+package sysprobe_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	sysprobe "github.com/pkrzeminski/sysprobe"
+)
+
+const hardwareManifest = `name: Hardware
+platform: linux
+tasks:
+  - name: Kernel Modules
+    command: printf 'snd_hda_intel 61440 3\nnvme 61440 2\n'
+  - name: Network Hardware
+    command: echo 'wlp2s0 link/ether 6c:2c:91:3a:7b:10'
+  - name: Sensors
+    command: echo 'waiting for the EC'; tail -f /dev/null
+checks:
+  - name: nvme
+    task: Kernel Modules
+    if: contains("nvme")
+    severity: info
+    message: NVMe storage driver loaded
+`
+
+var linux = sysprobe.Platform{OS: "linux", Distro: "test"}
+
+// loadHardware loads the hardware manifest
+func loadHardware(t *testing.T, opts ...sysprobe.Option) *sysprobe.Probes {
+	t.Helper()
+	source := sysprobe.Source{Name: "test", FS: fstest.MapFS{"hardware.yaml": {Data: []byte(hardwareManifest)}}}
+	probes, err := sysprobe.LoadProbes(append([]sysprobe.Option{sysprobe.WithPlatform(linux), sysprobe.WithSources(source)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return probes
+}
+
+// finished runs tasks and returns the results of the finished event
+func finished(t *testing.T, tasks []sysprobe.Task, opts ...sysprobe.Option) []sysprobe.Result {
+	t.Helper()
+	var results []sysprobe.Result
+	for event := range sysprobe.Run(context.Background(), tasks, opts...) {
+		if event.Type == sysprobe.EventFinished {
+			if event.Err != nil {
+				t.Fatal(event.Err)
+			}
+			results = event.Results
+		}
+	}
+	return results
+}
+
+// statuses returns the status of each result
+func statuses(results []sysprobe.Result) []sysprobe.Status {
+	var s []sysprobe.Status
+	for _, result := range results {
+		s = append(s, result.Status)
+	}
+	return s
+}
+
+func TestAPI(t *testing.T) {
+	t.Run("load", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			opts   []sysprobe.Option
+			tasks  []string
+			checks int
+		}{
+			{name: "all", tasks: []string{"Kernel Modules", "Network Hardware", "Sensors"}, checks: 1},
+			{name: "selected", opts: []sysprobe.Option{sysprobe.WithSelector(sysprobe.Selector{Names: []string{"Sensors"}})}, tasks: []string{"Sensors"}, checks: 1},
+			{name: "other platform", opts: []sysprobe.Option{sysprobe.WithPlatform(sysprobe.Platform{OS: "darwin"})}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				probes := loadHardware(t, tt.opts...)
+				var names []string
+				for _, task := range probes.Tasks {
+					names = append(names, task.Name)
+					if task.Category != "hardware" {
+						t.Errorf("%s is in %q", task.Name, task.Category)
+					}
+				}
+				if !slices.Equal(names, tt.tasks) || len(probes.Checks) != tt.checks {
+					t.Errorf("tasks %q, %d checks; want %q, %d", names, len(probes.Checks), tt.tasks, tt.checks)
+				}
+			})
+		}
+	})
+
+	t.Run("run", func(t *testing.T) {
+		tasks := loadHardware(t).Tasks
+
+		// The timeout applies to tasks that set none
+		results := finished(t, tasks, sysprobe.WithPlatform(linux), sysprobe.WithTimeout(200*time.Millisecond))
+		want := []sysprobe.Status{sysprobe.StatusSuccess, sysprobe.StatusSuccess, sysprobe.StatusTimedOut}
+		if got := statuses(results); !slices.Equal(got, want) {
+			t.Errorf("with a timeout: %v, want %v", got, want)
+		}
+
+		// Cancelling stops the task still running. Results come in task
+		// order, so the other two are done by then.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var started, done int
+		for event := range sysprobe.Run(ctx, tasks, sysprobe.WithPlatform(linux)) {
+			switch event.Type {
+			case sysprobe.EventStart:
+				started++
+			case sysprobe.EventDone:
+				if done++; done == 2 {
+					cancel()
+				}
+			case sysprobe.EventFinished:
+				results = event.Results
+			}
+		}
+		want[2] = sysprobe.StatusCancelled
+		if got := statuses(results); !slices.Equal(got, want) || started != 3 || done != 3 {
+			t.Errorf("cancelled: %v after %d starts and %d done, want %v", got, started, done, want)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		tasks := loadHardware(t).Tasks
+		recorder := sysprobe.NewRecorder(linux)
+		recorded := finished(t, tasks, sysprobe.WithPlatform(linux), sysprobe.WithTimeout(200*time.Millisecond), sysprobe.WithRecorder(recorder))
+
+		// The fixture is redacted like the results, and replays them without
+		// running anything
+		data, err := recorder.Fixture().Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "6c:2c:91:3a:7b:10") {
+			t.Errorf("fixture is not redacted:\n%s", data)
+		}
+		fixture, err := sysprobe.ParseFixture(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed := finished(t, fixture.Filter(tasks), sysprobe.WithPlatform(fixture.Platform), sysprobe.WithReplay(fixture))
+		if len(replayed) != len(recorded) {
+			t.Fatalf("replayed %d results, recorded %d", len(replayed), len(recorded))
+		}
+		for i, result := range replayed {
+			if result.Status != recorded[i].Status || result.Output != recorded[i].Output {
+				t.Errorf("replayed %+v, recorded %+v", result, recorded[i])
+			}
+		}
+
+		// A recorder need not come from NewRecorder
+		var bare sysprobe.Recorder
+		finished(t, tasks[:1], sysprobe.WithPlatform(linux), sysprobe.WithRecorder(&bare))
+		if f := bare.Fixture(); len(f.Tasks) != 1 {
+			t.Errorf("zero recorder fixture: %+v", f)
+		}
+	})
+
+	t.Run("render", func(t *testing.T) {
+		probes := loadHardware(t)
+		results := []sysprobe.Result{
+			{Name: "Kernel Modules", Category: "hardware", Status: sysprobe.StatusSuccess, Output: "snd_hda_intel 61440 3\nnvme 61440 2"},
+			{Name: "Sensors", Category: "hardware", Status: sysprobe.StatusTimedOut, Output: "waiting for the EC"},
+		}
+		findings, err := sysprobe.EvaluateChecks(probes.Checks, results)
+		if err != nil || len(findings) != 1 {
+			t.Fatalf("findings %+v, error %v", findings, err)
+		}
+
+		markdown, tokens, err := sysprobe.Render(results, sysprobe.FormatMarkdown,
+			sysprobe.WithPlatform(linux), sysprobe.WithFindings(findings))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens == 0 || !strings.Contains(markdown, findings[0].Message) || !strings.Contains(markdown, "**Sensors**: Timed Out") {
+			t.Errorf("markdown (%d tokens):\n%s", tokens, markdown)
+		}
+
+		// Both JSON formats read back as the same document
+		for _, format := range []sysprobe.Format{sysprobe.FormatJSON, sysprobe.FormatJSONL} {
+			text, _, err := sysprobe.Render(results, format, sysprobe.WithPlatform(linux))
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := sysprobe.ReadDocument(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if doc.Summary.Success != 1 || doc.Summary.TimedOut != 1 || len(doc.Tasks) != 2 || !strings.HasPrefix(doc.Tasks[1].Stdout, "waiting for the EC") {
+				t.Errorf("%s document: %+v", format, doc)
+			}
+		}
+
+		if _, _, err := sysprobe.Render(results, "yaml"); err == nil {
+			t.Error("unknown format: no error")
+		}
+	})
+}
+
+// TestRunPlaceholders checks that placeholders follow task order when the
+// tasks finish in reverse
+func TestRunPlaceholders(t *testing.T) {
+	var tasks []sysprobe.Task
+	for i := range 4 {
+		tasks = append(tasks, sysprobe.Task{
+			Name:    fmt.Sprintf("Peer %d", i+1),
+			Command: fmt.Sprintf("sleep 0.%d; echo 'peer 83.24.117.%d'", 4-i, i+1),
+		})
+	}
+
+	recorder := sysprobe.NewRecorder(linux)
+	var done []string
+	var results []sysprobe.Result
+	for event := range sysprobe.Run(context.Background(), tasks, sysprobe.WithPlatform(linux), sysprobe.WithWorkers(4), sysprobe.WithRecorder(recorder)) {
+		switch event.Type {
+		case sysprobe.EventDone:
+			done = append(done, event.Result.Name+": "+event.Result.Output)
+		case sysprobe.EventFinished:
+			results = event.Results
+		}
+	}
+
+	fixture := recorder.Fixture()
+	for i, task := range tasks {
+		want := fmt.Sprintf("%s: peer [ip-%d]", task.Name, i+1)
+		if i >= len(done) || done[i] != want {
+			t.Errorf("done events %q, want %q at %d", done, want, i)
+		}
+		if results[i].Output != fmt.Sprintf("peer [ip-%d]", i+1) {
+			t.Errorf("result %d: %q", i, results[i].Output)
+		}
+		if rec, ok := fixture.Lookup(task.Name); !ok || rec.Attempts[0].Stdout != results[i].Output+"\n" {
+			t.Errorf("recorded %s: %+v", task.Name, rec)
+		}
+	}
+}